@@ -0,0 +1,145 @@
+// Command replay plays back route requests recorded with RECORD_REQUESTS_FILE
+// against a running service, for load testing.
+//
+//	go run ./cmd/replay -file requests.jsonl -url http://localhost:8080/route -concurrency 8
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func main() {
+	file := flag.String("file", "requests.jsonl", "recorded requests, one JSON object per line")
+	target := flag.String("url", "http://localhost:8080/route", "route endpoint to replay against")
+	concurrency := flag.Int("concurrency", 4, "requests in flight at once")
+	repeat := flag.Int("repeat", 1, "times to replay the whole file")
+	flag.Parse()
+
+	requests, err := readRequests(*file)
+	if err != nil {
+		log.Fatalf("reading %s: %v", *file, err)
+	}
+	if len(requests) == 0 {
+		log.Fatalf("%s has no requests", *file)
+	}
+
+	jobs := make(chan recorded)
+	var (
+		mu        sync.Mutex
+		statuses  = map[string]int{}
+		latencies []time.Duration
+		wg        sync.WaitGroup
+	)
+	client := &http.Client{Timeout: 2 * time.Minute}
+
+	for w := 0; w < max(*concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range jobs {
+				status, elapsed := send(client, *target, req)
+				mu.Lock()
+				statuses[status]++
+				latencies = append(latencies, elapsed)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i := 0; i < *repeat; i++ {
+		for _, req := range requests {
+			jobs <- req
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	report(statuses, latencies, time.Since(start))
+}
+
+// recorded is one line of the file written by the service's recorder: the
+// query string of the original request and its input, kept raw so it is
+// posted back byte for byte
+type recorded struct {
+	Query string          `json:"query"`
+	Input json.RawMessage `json:"input"`
+}
+
+// readRequests parses the non-blank lines of a recorded JSONL file
+func readRequests(path string) ([]recorded, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var requests []recorded
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req recorded
+		if err := json.Unmarshal(line, &req); err != nil || len(req.Input) == 0 {
+			return nil, fmt.Errorf("line %d is not a recorded request", n)
+		}
+		requests = append(requests, req)
+	}
+	return requests, scanner.Err()
+}
+
+// send posts one request, with its recorded query string, and returns its
+// status ("200", "500", or the transport error) and latency
+func send(client *http.Client, target string, req recorded) (string, time.Duration) {
+	if req.Query != "" {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + req.Query
+	}
+	start := time.Now()
+	resp, err := client.Post(target, "application/json", bytes.NewReader(req.Input))
+	if err != nil {
+		return "error", time.Since(start)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return fmt.Sprint(resp.StatusCode), time.Since(start)
+}
+
+func report(statuses map[string]int, latencies []time.Duration, total time.Duration) {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+
+	fmt.Printf("%d requests in %s (%.1f req/s)\n", len(latencies), total.Round(time.Millisecond),
+		float64(len(latencies))/total.Seconds())
+	codes := make([]string, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Printf("  %s: %d\n", code, statuses[code])
+	}
+	fmt.Printf("latency p50=%s p90=%s p99=%s max=%s\n",
+		percentile(0.5).Round(time.Millisecond), percentile(0.9).Round(time.Millisecond),
+		percentile(0.99).Round(time.Millisecond), latencies[len(latencies)-1].Round(time.Millisecond))
+}
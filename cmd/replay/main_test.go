@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	lines := `{"query":"format=gpx&summary=true","input":{"OriginAddress":"Mission Dolores","Destination":"Ferry Building"}}
+
+{"input":{"Destination":"Ferry Building","Mode":"walking"}}
+`
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	requests, err := readRequests(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type received struct{ query, body string }
+	var got []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, received{r.URL.RawQuery, string(body)})
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	for _, req := range requests {
+		if status, _ := send(server.Client(), server.URL+"/route", req); status != "200" {
+			t.Errorf("status = %s, want 200", status)
+		}
+	}
+	want := []received{
+		{"format=gpx&summary=true", `{"OriginAddress":"Mission Dolores","Destination":"Ferry Building"}`},
+		{"", `{"Destination":"Ferry Building","Mode":"walking"}`},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("server got %d requests, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadRequestsRejectsInvalidLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	if err := os.WriteFile(path, []byte("not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRequests(path); err == nil {
+		t.Error("readRequests() accepted a line that isn't a recorded request")
+	}
+}
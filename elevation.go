@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bike-router/entities"
+	"bike-router/router"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxElevationPoints bounds one /elevation request; larger ones are chunked
+// into an Elevation API call per 512 points
+const maxElevationPoints = 10000
+
+// elevationHandler returns the elevation of arbitrary points, in the order given
+func elevationHandler(client router.MapsClient, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, entities.CodeMethodNotAllowed, "only POST allowed")
+			return
+		}
+
+		var req entities.ElevationInput
+		if err := decodeJSONBody(r.Body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, entities.CodeInvalidJSON, "invalid json: "+err.Error())
+			return
+		}
+		if len(req.Points) == 0 {
+			writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, "no points given")
+			return
+		}
+		if len(req.Points) > maxElevationPoints {
+			writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, fmt.Sprintf("too many points: %d given, at most %d allowed", len(req.Points), maxElevationPoints))
+			return
+		}
+		for i, p := range req.Points {
+			if err := p.Validate(); err != nil {
+				writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, fmt.Sprintf("invalid point %d: %s", i+1, err))
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		elevations, err := router.Elevations(ctx, client, req.Points)
+		if err != nil {
+			writeRouteError(w, ctx, err)
+			return
+		}
+
+		out := entities.ElevationOutput{Points: make([]entities.ElevationPoint, len(req.Points))}
+		for i, p := range req.Points {
+			out.Points[i] = entities.ElevationPoint{Coordinates: p, Elevation: elevations[i]}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
@@ -1,38 +1,305 @@
 package entities
 
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
 type Coordinates struct {
 	Lat float64 `json:"lat"`
 	Lng float64 `json:"lng"`
 }
 
+// Validate rejects coordinates off the globe: latitude outside [-90, 90],
+// longitude outside [-180, 180], or either not a finite number
+func (c Coordinates) Validate() error {
+	if math.IsNaN(c.Lat) || math.IsInf(c.Lat, 0) || c.Lat < -90 || c.Lat > 90 {
+		return fmt.Errorf("latitude %v must be a number between -90 and 90", c.Lat)
+	}
+	if math.IsNaN(c.Lng) || math.IsInf(c.Lng, 0) || c.Lng < -180 || c.Lng > 180 {
+		return fmt.Errorf("longitude %v must be a number between -180 and 180", c.Lng)
+	}
+	return nil
+}
+
+// Name sources tell clients where a street name or description came from,
+// from most to least trustworthy.
+const (
+	NameSourceManeuverHTML   = "maneuver-html"   // parsed from Google's step instruction
+	NameSourceReverseGeocode = "reverse-geocode" // route component from reverse geocoding
+	NameSourceFallback       = "fallback"        // raw instruction text or placeholder
+)
+
+// BoundaryCrossing marks the first point inside a new administrative area
+type BoundaryCrossing struct {
+	Level string `json:"level"` // state, county or locality
+	Name  string `json:"name"`  // Name of the area being entered
+}
+
 type Point struct {
-	Lat         float64 `json:"lat"`
-	Lng         float64 `json:"lng"`
-	Description string  `json:"description,omitempty"`
-	Elevation   float64 `json:"elevation"` // meters
-	IsDownHill  bool    `json:"is_down_hill"`
+	Lat          float64 `json:"lat"`
+	Lng          float64 `json:"lng"`
+	Description  string  `json:"description,omitempty"`
+	NameSource   string  `json:"name_source,omitempty"`
+	PlaceID      string  `json:"place_id,omitempty"` // Google place ID from reverse geocoding
+	Elevation    float64 `json:"elevation"`          // meters
+	IsDownHill   bool    `json:"is_down_hill"`       // The segment to the next point drops more than the threshold
+	GradePercent float64 `json:"grade_percent"`      // Slope to the next point, positive uphill
+
+	IsIntersection bool `json:"is_intersection"` // Heuristic, from reverse geocoding
+
+	BoundaryCrossing *BoundaryCrossing `json:"boundary_crossing,omitempty"` // Set with ?boundaries=true
 }
 
+// Instruction is one step of the route. DistanceMeters and DurationSeconds
+// are cumulative up to where the step begins, i.e. where the rider has to act
+// on it: the first instruction is always 0 and the arrival carries the total.
 type Instruction struct {
-	Instruction      string  `json:"instruction"`       // HTML instruction from Google (e.g., "Turn <b>left</b> onto Market St")
-	DistanceMeters   int     `json:"distance_meters"`   // Distance from start to this instruction
-	DurationSeconds  int     `json:"duration_seconds"`  // Time from start to this instruction
-	Maneuver         string  `json:"maneuver"`          // turn-left, turn-right, straight, etc.
-	StreetName       string  `json:"street_name"`       // Extracted street name
-	StartLocation    Coordinates `json:"start_location"`
+	Instruction     string      `json:"instruction"`           // HTML instruction from Google (e.g., "Turn <b>left</b> onto Market St")
+	DistanceMeters  int         `json:"distance_meters"`       // Distance from the route start to this step's start
+	DurationSeconds int         `json:"duration_seconds"`      // Time from the route start to this step's start
+	Maneuver        string      `json:"maneuver"`              // turn-left, turn-right, straight, etc., inferred from the text
+	StreetName      string      `json:"street_name"`           // Extracted street name
+	NameSource      string      `json:"name_source"`           // Where StreetName came from (see NameSource* constants)
+	TurnAngle       float64     `json:"turn_angle"`            // Signed heading change in degrees, positive = right
+	TravelMode      string      `json:"travel_mode,omitempty"` // Mode of this step (walking, transit, ...)
+	StartLocation   Coordinates `json:"start_location"`
+	PointIndex      int         `json:"point_index"`     // Index of the closest entry in the route's Points
+	AccessibleText  string      `json:"accessible_text"` // Unabbreviated sentence for screen readers and TTS
+	EstimatedTime   string      `json:"estimated_time"`  // RFC3339 clock time at this instruction
+	DistanceText    string      `json:"distance_text"`   // DistanceMeters for display in the route's Units, e.g. "1.2 mi"
+}
+
+type Address struct {
+	StreetNumber       string `json:"street_number,omitempty"`
+	Route              string `json:"route,omitempty"`
+	Locality           string `json:"locality,omitempty"`
+	AdministrativeArea string `json:"administrative_area,omitempty"`
+	PostalCode         string `json:"postal_code,omitempty"`
+	Country            string `json:"country,omitempty"`
+	CountryCode        string `json:"country_code,omitempty"`
+	FormattedAddress   string `json:"formatted_address,omitempty"`
+}
+
+// Bounds is the smallest lat/lng box holding a route, for fitting a map to it
+type Bounds struct {
+	NorthEast Coordinates `json:"northeast"`
+	SouthWest Coordinates `json:"southwest"`
+}
+
+// DistanceMarker sits at a whole kilometer, or mile in imperial units, along
+// the route
+type DistanceMarker struct {
+	Coordinates
+	Value int `json:"value"` // Kilometers or miles from the start, in the route's Units
+}
+
+// RoutingHandoff is an engine-neutral description of the trip for re-routing
+// through OSRM, Valhalla or similar
+type RoutingHandoff struct {
+	Coordinates     [][2]float64 `json:"coordinates"`      // [lng, lat] pairs: origin, waypoints, destination
+	Mode            string       `json:"mode"`             // Google travel mode
+	OSRMProfile     string       `json:"osrm_profile"`     // foot, bike or car
+	ValhallaCosting string       `json:"valhalla_costing"` // pedestrian, bicycle, auto or multimodal
 }
 
 type Route struct {
-	ID           int           `json:"id"`
-	Points       []Point       `json:"points"`        // Simplified route polyline for map display
-	Instructions []Instruction `json:"instructions"`  // Turn-by-turn instructions
+	ID                   int              `json:"id"`
+	Points               []Point          `json:"points"`                        // Simplified route polyline for map display
+	Instructions         []Instruction    `json:"instructions"`                  // Turn-by-turn instructions
+	DestinationAddress   *Address         `json:"destination_address,omitempty"` // Structured address of the final leg's end
+	GoogleMapsURL        string           `json:"google_maps_url"`               // Link opening the same trip in Google Maps
+	TotalDistanceMeters  int              `json:"total_distance_meters"`         // Sum of Google's leg distances
+	TotalDurationSeconds int              `json:"total_duration_seconds"`        // Sum of Google's leg durations
+	TotalAscentMeters    float64          `json:"total_ascent_meters"`           // Sum of all climbs along the points
+	TotalDescentMeters   float64          `json:"total_descent_meters"`          // Sum of all descents along the points
+	Advisories           []string         `json:"advisories,omitempty"`          // Weather-based ride advisories, when enabled
+	StopCount            int              `json:"stop_count"`                    // Approximate stops: turns plus intersections
+	Handoff              *RoutingHandoff  `json:"handoff,omitempty"`             // Routing-engine handoff payload (?handoff=true)
+	DistanceMarkers      []DistanceMarker `json:"distance_markers"`              // Kilometer (imperial: mile) tick marks along the points
+	CO2SavedGrams        int              `json:"co2_saved_grams,omitempty"`     // Versus driving the same distance; not set for driving
+	EstimatedCalories    float64          `json:"estimated_calories,omitempty"`  // kcal burned, only when RouteInput.RiderWeightKg is set
+	Hash                 string           `json:"hash"`                          // SHA-256 of the points and instructions, for change detection
+	Units                string           `json:"units"`                         // metric or imperial: the unit system of the *_text fields; numeric fields stay metric
+	OverviewPolyline     string           `json:"overview_polyline"`             // Google's encoded, smoothed polyline of the whole trip
+	DecodedPolyline      []Coordinates    `json:"decoded_polyline,omitempty"`    // Full-resolution step geometry (?decoded=true)
+	Bounds               Bounds           `json:"bounds"`                        // Viewport enclosing the route
+	FallbackMode         string           `json:"fallback_mode,omitempty"`       // Mode used instead of the requested one, which found no route (RouteInput.TransitFallback)
+
+	// E-bike range planning, only when RouteInput.BatteryWh is set
+	EstimatedBatteryUsedWh float64 `json:"estimated_battery_used_wh,omitempty"`
+	BatterySufficient      *bool   `json:"battery_sufficient,omitempty"`
+
+	// Debug output (?debug=true)
+	RawPointCount        int `json:"raw_point_count,omitempty"`        // Points before simplification
+	SimplifiedPointCount int `json:"simplified_point_count,omitempty"` // Points after simplification
 }
 
 type RouteOutput struct {
-	Routes []Route `json:"routes"`
+	Routes  []Route     `json:"routes"`
+	Request *RouteInput `json:"request,omitempty"` // Input after defaults were applied (?echo=true)
+}
+
+// RouteSummary is the cheap overview of a route returned by ?summary=true
+type RouteSummary struct {
+	ID                  int         `json:"id"`
+	DistanceMeters      int         `json:"distance_meters"`
+	DurationSeconds     int         `json:"duration_seconds"`
+	ElevationGainMeters float64     `json:"elevation_gain_meters"` // From elevations sampled along the overview polyline
+	Difficulty          string      `json:"difficulty"`            // easy, moderate or hard
+	Center              Coordinates `json:"center"`                // Center of the route's bounds
+}
+
+type RouteSummaryOutput struct {
+	Routes []RouteSummary `json:"routes"`
+}
+
+type ElevationInput struct {
+	Points []Coordinates
+}
+
+type ElevationOutput struct {
+	Points []ElevationPoint `json:"points"` // In the order requested
+}
+
+type ElevationPoint struct {
+	Coordinates
+	Elevation float64 `json:"elevation"` // meters
 }
 
+type ReachabilityInput struct {
+	Origin        Coordinates
+	Mode          string  // walking, bicycling (default), transit or driving
+	BudgetMinutes float64 // Travel time available
+}
+
+// ReachabilityOutput is a circle approximating where the budget gets you.
+// It is a coarse estimate from typical speeds, not a true isochrone.
+type ReachabilityOutput struct {
+	Center       Coordinates `json:"center"`
+	RadiusMeters float64     `json:"radius_meters"`
+	Mode         string      `json:"mode"`
+}
+
+// HealthResponse is the body of /health and /ready
+type HealthResponse struct {
+	Status string `json:"status"` // "ok", or what is wrong
+}
+
+// CacheStats reports one lookup cache on /metrics
+type CacheStats struct {
+	Name       string `json:"name"`
+	Size       int    `json:"size"`        // Entries currently held
+	MaxEntries int    `json:"max_entries"` // 0 means unbounded
+	TTLSeconds int    `json:"ttl_seconds"` // 0 means entries never expire
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Evictions  uint64 `json:"evictions"` // Entries dropped for size or age
+}
+
+type MetricsOutput struct {
+	Caches []CacheStats `json:"caches"`
+}
+
+// ErrorCode is the stable, machine-readable reason in an error response.
+// Clients can switch on it; the message is for humans and may change.
+type ErrorCode string
+
+const (
+	CodeNotFound         ErrorCode = "not_found" // no endpoint at the path
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+	CodeInvalidJSON      ErrorCode = "invalid_json"
+	CodeInvalidRequest   ErrorCode = "invalid_request"   // well-formed JSON with invalid values
+	CodeNoRoutes         ErrorCode = "no_routes"         // Google found no route
+	CodeNoMatchingRoute  ErrorCode = "no_matching_route" // routes exist but none meets the request's limits
+	CodeMultipleRoutes   ErrorCode = "multiple_routes"   // ?single=true but more than one route qualified
+	CodeUpstream         ErrorCode = "upstream_error"    // Maps API call failed
+	CodeUpstreamDenied   ErrorCode = "upstream_denied"   // Google refused the API key
+	CodeAddressNotFound  ErrorCode = "address_not_found" // Google couldn't geocode an address in the request
+	CodeOverQuota        ErrorCode = "over_quota"        // Maps API quota exhausted
+	CodeTimeout          ErrorCode = "timeout"           // Maps API call or the whole request timed out
+	CodeRateLimited      ErrorCode = "rate_limited"      // no Maps rate limiter token before the deadline
+	CodeCanceled         ErrorCode = "canceled"          // client disconnected before the response
+)
+
+type ErrorResponse struct {
+	Error string    `json:"error"`
+	Code  ErrorCode `json:"code"`
+}
+
+// Instruction verbosity levels accepted in RouteInput.Verbosity
+const (
+	VerbosityMinimal = "minimal" // turns and arrival only
+	VerbosityNormal  = "normal"  // every Google step (default)
+	VerbosityVerbose = "verbose" // every Google step, with transit steps split into their sub-steps
+)
+
 type RouteInput struct {
-	Origin      Coordinates
-	Destination string
+	Origin            *Coordinates  // Takes precedence over OriginAddress when set
+	OriginAddress     string        // Free-text start, geocoded by Google
+	Destination       string        // Address or place name
+	DestinationCoords *Coordinates  // Takes precedence over Destination when set
+	Mode              string        // walking, bicycling (default), driving or transit
+	TransitFallback   bool          // With transit, walk the whole trip when Google finds no transit route
+	Units             string        // metric (default) or imperial, for display text
+	Language          string        // Google language code (e.g. "de", "pt-BR") for instructions and addresses; the service's own parsing and phrases are English only
+	Waypoints         []Coordinates // Intermediate stops, visited in order
+	Alternatives      bool          // Ask Google for alternative routes; one route by default
+	Leg               int           // 1-based leg to return alone, distances rebased to its start; 0 returns all
+	Verbosity         string        // minimal, normal (default) or verbose
+	Avoid             []string      // Route features to avoid: highways, tolls, ferries, indoor, unpaved
+	Prefer            string        // bikelanes: pick the alternative mentioning the most bike infrastructure
+
+	PreserveTurnDegrees float64 // Keep close points where the route turns more than this; 0 disables
+
+	Simplify              string  // distance (default) or douglas-peucker
+	SimplifyEpsilonMeters float64 // Douglas-Peucker tolerance; defaults to 10
+	SimplifyMeters        float64 // Distance threshold; defaults to 50
+	ZigZagMeters          float64 // Backtracks shorter than this are removed; defaults to 30, negative disables
+
+	MaxElevationGainMeters float64 // Reject routes climbing more than this; 0 disables
+	MaxGradePercent        float64 // Reject routes with any climb steeper than this; 0 disables
+
+	BatteryWh   float64 // E-bike battery capacity; enables the battery estimate
+	AssistLevel string  // eco, tour (default), sport or turbo
+
+	RiderWeightKg float64 // Enables the calorie estimate for walking and bicycling
+
+	ElevationSamplesPerKm float64 // Summary elevation sampling density; 0 uses a fixed count
+
+	// RFC3339 or unix seconds; at most one of the two. Transit routes are
+	// scheduled for them, and they set the instructions' clock times.
+	DepartureTime Timestamp `json:",omitzero"` // Defaults to now when neither is set
+	ArrivalTime   Timestamp `json:",omitzero"`
+}
+
+// Timestamp is a time given in JSON as an RFC3339 string or as unix seconds.
+// It is written back as RFC3339, or null when unset.
+type Timestamp struct {
+	time.Time
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return t.Time.MarshalJSON()
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return t.Time.UnmarshalJSON(data)
+	}
+	var seconds int64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("time must be an RFC3339 string or unix seconds: %w", err)
+	}
+	t.Time = time.Unix(seconds, 0).UTC()
+	return nil
 }
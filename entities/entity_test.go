@@ -0,0 +1,110 @@
+package entities
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCoordinatesValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     Coordinates
+		valid bool
+	}{
+		{"origin", Coordinates{0, 0}, true},
+		{"san francisco", Coordinates{37.7749, -122.4194}, true},
+		{"poles and antimeridian", Coordinates{90, 180}, true},
+		{"south-west corner", Coordinates{-90, -180}, true},
+		{"latitude too high", Coordinates{90.0001, 0}, false},
+		{"latitude too low", Coordinates{-91, 0}, false},
+		{"longitude too high", Coordinates{0, 180.5}, false},
+		{"longitude too low", Coordinates{0, -181}, false},
+		{"swapped lat/lng", Coordinates{-122.4194, 37.7749}, false},
+		{"NaN latitude", Coordinates{math.NaN(), 0}, false},
+		{"NaN longitude", Coordinates{0, math.NaN()}, false},
+		{"infinite latitude", Coordinates{math.Inf(1), 0}, false},
+		{"infinite longitude", Coordinates{0, math.Inf(-1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.c.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate(%v) = %v, want valid=%v", tt.c, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestTimestampUnmarshalJSON(t *testing.T) {
+	want := time.Date(2026, 5, 1, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		json    string
+		want    time.Time
+		wantErr bool
+	}{
+		{"RFC3339", `"2026-05-01T08:30:00-07:00"`, want, false},
+		{"unix seconds", "1777649400", want, false},
+		{"null", "null", time.Time{}, false},
+		{"zero time", `"0001-01-01T00:00:00Z"`, time.Time{}, false},
+		{"not RFC3339", `"May 1st"`, time.Time{}, true},
+		{"fractional seconds", "1777649400.5", time.Time{}, true},
+		{"boolean", "true", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ts Timestamp
+			err := json.Unmarshal([]byte(tt.json), &ts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) = %v, want error %v", tt.json, err, tt.wantErr)
+			}
+			if !ts.Equal(tt.want) {
+				t.Errorf("Unmarshal(%s) = %v, want %v", tt.json, ts.Time, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampMarshalJSON(t *testing.T) {
+	departure := time.Date(2026, 5, 1, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		input RouteInput
+		want  []string // substrings of the JSON
+		never []string
+	}{
+		{"unset times are left out", RouteInput{Destination: "Ferry Building"}, nil, []string{"DepartureTime", "ArrivalTime", "0001-01-01"}},
+		{"set time round-trips", RouteInput{DepartureTime: Timestamp{departure}}, []string{`"DepartureTime":"2026-05-01T08:30:00Z"`}, []string{"ArrivalTime"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(data), s) {
+					t.Errorf("%s lacks %s", data, s)
+				}
+			}
+			for _, s := range tt.never {
+				if strings.Contains(string(data), s) {
+					t.Errorf("%s contains %s", data, s)
+				}
+			}
+			var back RouteInput
+			if err := json.Unmarshal(data, &back); err != nil {
+				t.Fatal(err)
+			}
+			if !back.DepartureTime.Equal(tt.input.DepartureTime.Time) || !back.ArrivalTime.IsZero() {
+				t.Errorf("round trip gave departure %v, arrival %v", back.DepartureTime, back.ArrivalTime)
+			}
+		})
+	}
+
+	if data, _ := json.Marshal(Timestamp{}); string(data) != "null" {
+		t.Errorf("zero Timestamp marshals as %s, want null", data)
+	}
+}
@@ -0,0 +1,83 @@
+package entities
+
+import "encoding/json"
+
+// ContentTypeGeoJSON is the Accept/Content-Type value for the GeoJSON route form
+const ContentTypeGeoJSON = "application/geo+json"
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   geoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// geoJSONGeometry holds a Point ([lng, lat]) or a LineString ([][lng, lat])
+type geoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// MarshalGeoJSON encodes the output as a FeatureCollection: per route, a
+// LineString of its points followed by a Point for each instruction.
+// Coordinates are [lng, lat], as GeoJSON requires.
+func (o RouteOutput) MarshalGeoJSON() []byte {
+	var features []geoJSONFeature
+	for _, rt := range o.Routes {
+		features = append(features, rt.geoJSONFeatures()...)
+	}
+	return marshalGeoJSON(features)
+}
+
+// MarshalGeoJSON encodes a single route's features, for ?single=true.
+func (r Route) MarshalGeoJSON() []byte {
+	return marshalGeoJSON(r.geoJSONFeatures())
+}
+
+func (r Route) geoJSONFeatures() []geoJSONFeature {
+	line := make([][2]float64, len(r.Points))
+	for i, p := range r.Points {
+		line[i] = [2]float64{p.Lng, p.Lat}
+	}
+	features := []geoJSONFeature{{
+		Type:     "Feature",
+		Geometry: geoJSONGeometry{Type: "LineString", Coordinates: line},
+		Properties: map[string]any{
+			"route_id":               r.ID,
+			"total_distance_meters":  r.TotalDistanceMeters,
+			"total_duration_seconds": r.TotalDurationSeconds,
+			"total_ascent_meters":    r.TotalAscentMeters,
+		},
+	}}
+	for _, inst := range r.Instructions {
+		features = append(features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONGeometry{
+				Type:        "Point",
+				Coordinates: [2]float64{inst.StartLocation.Lng, inst.StartLocation.Lat},
+			},
+			Properties: map[string]any{
+				"route_id":         r.ID,
+				"instruction":      inst.Instruction,
+				"maneuver":         inst.Maneuver,
+				"street_name":      inst.StreetName,
+				"distance_meters":  inst.DistanceMeters,
+				"duration_seconds": inst.DurationSeconds,
+			},
+		})
+	}
+	return features
+}
+
+func marshalGeoJSON(features []geoJSONFeature) []byte {
+	if features == nil {
+		features = []geoJSONFeature{}
+	}
+	// Only strings, numbers and coordinate arrays, which always encode
+	b, _ := json.Marshal(geoJSONCollection{Type: "FeatureCollection", Features: features})
+	return b
+}
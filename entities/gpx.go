@@ -0,0 +1,63 @@
+package entities
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// ContentTypeGPX is the Accept/Content-Type value for the GPX track form
+const ContentTypeGPX = "application/gpx+xml"
+
+type gpxDoc struct {
+	XMLName xml.Name   `xml:"gpx"`
+	Version string     `xml:"version,attr"`
+	Creator string     `xml:"creator,attr"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Tracks  []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name    string     `xml:"name"`
+	Segment []gpxTrkPt `xml:"trkseg>trkpt"`
+}
+
+type gpxTrkPt struct {
+	Lat       float64 `xml:"lat,attr"`
+	Lon       float64 `xml:"lon,attr"`
+	Elevation float64 `xml:"ele"`
+}
+
+// MarshalGPX encodes the output as a GPX 1.1 document with one track per
+// route, for import into cycling computers
+func (o RouteOutput) MarshalGPX() []byte {
+	tracks := make([]gpxTrack, len(o.Routes))
+	for i, rt := range o.Routes {
+		tracks[i] = rt.gpxTrack()
+	}
+	return marshalGPX(tracks)
+}
+
+// MarshalGPX encodes a single route as a one-track GPX document, for ?single=true.
+func (r Route) MarshalGPX() []byte {
+	return marshalGPX([]gpxTrack{r.gpxTrack()})
+}
+
+func (r Route) gpxTrack() gpxTrack {
+	trk := gpxTrack{Name: fmt.Sprintf("Route %d", r.ID), Segment: make([]gpxTrkPt, len(r.Points))}
+	for i, p := range r.Points {
+		trk.Segment[i] = gpxTrkPt{Lat: p.Lat, Lon: p.Lng, Elevation: p.Elevation}
+	}
+	return trk
+}
+
+func marshalGPX(tracks []gpxTrack) []byte {
+	doc := gpxDoc{
+		Version: "1.1",
+		Creator: "bike-router",
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Tracks:  tracks,
+	}
+	// Only plain strings and floats, which always encode
+	b, _ := xml.MarshalIndent(doc, "", "  ")
+	return append([]byte(xml.Header), b...)
+}
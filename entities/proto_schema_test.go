@@ -0,0 +1,335 @@
+package entities
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// loadRouteProto reads ../proto/route.proto into a descriptor. The file only
+// uses flat messages of scalar, message, repeated and optional fields, which
+// is all this parser understands; anything else fails the test.
+func loadRouteProto(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	f, err := os.Open("../proto/route.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scalars := map[string]descriptorpb.FieldDescriptorProto_Type{
+		"double": descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+		"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+		"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	}
+	file := &descriptorpb.FileDescriptorProto{Name: proto.String("route.proto"), Syntax: proto.String("proto3")}
+	var msg *descriptorpb.DescriptorProto
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "syntax ") || strings.HasPrefix(line, "option "):
+		case strings.HasPrefix(line, "package "):
+			file.Package = proto.String(strings.TrimSuffix(strings.TrimPrefix(line, "package "), ";"))
+		case strings.HasPrefix(line, "message ") && strings.HasSuffix(line, "{"):
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "message "), "{"))
+			msg = &descriptorpb.DescriptorProto{Name: proto.String(name)}
+		case line == "}" && msg != nil:
+			file.MessageType = append(file.MessageType, msg)
+			msg = nil
+		case msg != nil && strings.HasSuffix(line, ";"):
+			words := strings.Fields(strings.NewReplacer("=", " ", ";", " ").Replace(line))
+			field := &descriptorpb.FieldDescriptorProto{Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()}
+			switch words[0] {
+			case "repeated":
+				field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+				words = words[1:]
+			case "optional":
+				// proto3 optional fields sit in a synthetic oneof of their own
+				field.Proto3Optional = proto.Bool(true)
+				field.OneofIndex = proto.Int32(int32(len(msg.OneofDecl)))
+				msg.OneofDecl = append(msg.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String("_" + words[2])})
+				words = words[1:]
+			}
+			if len(words) != 3 {
+				t.Fatalf("route.proto:%d: can't parse %q", n, line)
+			}
+			num, err := strconv.Atoi(words[2])
+			if err != nil {
+				t.Fatalf("route.proto:%d: %v", n, err)
+			}
+			field.Name, field.Number, field.JsonName = proto.String(words[1]), proto.Int32(int32(num)), proto.String(words[1])
+			if typ, ok := scalars[words[0]]; ok {
+				field.Type = typ.Enum()
+			} else {
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String("." + file.GetPackage() + "." + words[0])
+			}
+			msg.Field = append(msg.Field, field)
+		default:
+			t.Fatalf("route.proto:%d: can't parse %q", n, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatalf("route.proto: %v", err)
+	}
+	return fd
+}
+
+// visitMessages calls fn for m and every message nested in it
+func visitMessages(m protoreflect.Message, fn func(protoreflect.Message)) {
+	fn(m)
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Message() == nil:
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				visitMessages(v.List().Get(i).Message(), fn)
+			}
+		default:
+			visitMessages(v.Message(), fn)
+		}
+		return true
+	})
+}
+
+// TestMarshalProtoMatchesSchema decodes MarshalProto's output with the
+// schema in route.proto: every byte has to land in a declared field of the
+// right type, and a fully populated output has to fill every declared field.
+func TestMarshalProtoMatchesSchema(t *testing.T) {
+	fd := loadRouteProto(t)
+	desc := fd.Messages().ByName("RouteOutput")
+	if desc == nil {
+		t.Fatal("route.proto has no RouteOutput")
+	}
+	decoded := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(testRouteOutput().MarshalProto(), decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	set := map[protoreflect.FullName]map[protoreflect.Name]bool{}
+	visitMessages(decoded, func(m protoreflect.Message) {
+		name := m.Descriptor().FullName()
+		if unknown := m.GetUnknown(); len(unknown) > 0 {
+			t.Errorf("%s: %d bytes match no field in route.proto", name, len(unknown))
+		}
+		if set[name] == nil {
+			set[name] = map[protoreflect.Name]bool{}
+		}
+		m.Range(func(f protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			set[name][f.Name()] = true
+			return true
+		})
+	})
+
+	messages := fd.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		m := messages.Get(i)
+		if set[m.FullName()] == nil {
+			t.Errorf("%s is never encoded", m.Name())
+			continue
+		}
+		for j := 0; j < m.Fields().Len(); j++ {
+			if f := m.Fields().Get(j); !set[m.FullName()][f.Name()] {
+				t.Errorf("%s.%s is declared but never encoded", m.Name(), f.Name())
+			}
+		}
+	}
+}
+
+// TestMarshalProtoValues decodes MarshalProto's output with route.proto and
+// compares every field with the Go value it was encoded from, so a field
+// written under the wrong number, or as the wrong type, fails by name
+func TestMarshalProtoValues(t *testing.T) {
+	desc := loadRouteProto(t).Messages().ByName("RouteOutput")
+	decoded := dynamicpb.NewMessage(desc)
+	out := testRouteOutput()
+	if err := proto.Unmarshal(out.MarshalProto(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	compareProto(t, "RouteOutput", reflect.ValueOf(out), decoded)
+}
+
+var timestampType = reflect.TypeOf(Timestamp{})
+
+// compareProto checks each field of the decoded message m against the field
+// of the Go struct v with the same JSON name
+func compareProto(t *testing.T, path string, v reflect.Value, m protoreflect.Message) {
+	t.Helper()
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		name := path + "." + string(f.Name())
+		goField, ok := fieldByJSONName(v, string(f.Name()))
+		if !ok {
+			t.Errorf("%s: no Go field", name)
+			continue
+		}
+		if goField.Kind() == reflect.Pointer {
+			if goField.IsNil() {
+				if m.Has(f) {
+					t.Errorf("%s: set, want unset for a nil %s", name, goField.Type())
+				}
+				continue
+			}
+			goField = goField.Elem()
+		}
+		if f.IsList() {
+			list := m.Get(f).List()
+			if goField.Kind() != reflect.Slice || goField.Len() != list.Len() {
+				t.Errorf("%s: %d elements, want %d", name, list.Len(), goField.Len())
+				continue
+			}
+			for j := 0; j < list.Len(); j++ {
+				compareProtoValue(t, fmt.Sprintf("%s[%d]", name, j), f, goField.Index(j), list.Get(j))
+			}
+			continue
+		}
+		compareProtoValue(t, name, f, goField, m.Get(f))
+	}
+}
+
+// compareProtoValue checks one decoded value, of field f's type, against the
+// Go value it came from
+func compareProtoValue(t *testing.T, name string, f protoreflect.FieldDescriptor, v reflect.Value, got protoreflect.Value) {
+	t.Helper()
+	switch {
+	case f.Kind() == protoreflect.DoubleKind && v.Kind() == reflect.Float64:
+		if got.Float() != v.Float() {
+			t.Errorf("%s = %v, want %v", name, got.Float(), v.Float())
+		}
+	case f.Kind() == protoreflect.Int64Kind && v.Kind() == reflect.Int:
+		if got.Int() != v.Int() {
+			t.Errorf("%s = %v, want %v", name, got.Int(), v.Int())
+		}
+	case f.Kind() == protoreflect.BoolKind && v.Kind() == reflect.Bool:
+		if got.Bool() != v.Bool() {
+			t.Errorf("%s = %v, want %v", name, got.Bool(), v.Bool())
+		}
+	case f.Kind() == protoreflect.StringKind && v.Kind() == reflect.String:
+		if got.String() != v.String() {
+			t.Errorf("%s = %q, want %q", name, got.String(), v.String())
+		}
+	case f.Kind() == protoreflect.StringKind && v.Type() == timestampType:
+		if want := v.Interface().(Timestamp).Format(time.RFC3339Nano); got.String() != want {
+			t.Errorf("%s = %q, want %q", name, got.String(), want)
+		}
+	case f.Kind() == protoreflect.MessageKind && v.Kind() == reflect.Struct:
+		compareProto(t, name, v, got.Message())
+	case f.Kind() == protoreflect.MessageKind && v.Type() == reflect.TypeOf([2]float64{}):
+		// The JSON [lng, lat] pairs of the handoff, as Coordinates
+		pair := Coordinates{Lat: v.Index(1).Float(), Lng: v.Index(0).Float()}
+		compareProto(t, name, reflect.ValueOf(pair), got.Message())
+	default:
+		t.Errorf("%s: route.proto has %s, the Go field is %s", name, f.Kind(), v.Type())
+	}
+}
+
+// fieldByJSONName finds a struct field by its JSON name, or its Go name in
+// snake_case when untagged, looking into embedded structs
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Anonymous && f.Type != timestampType {
+			if field, ok := fieldByJSONName(v.Field(i), name); ok {
+				return field, true
+			}
+			continue
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "" {
+			tag = snakeCase(f.Name)
+		}
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// TestRouteProtoNamesMatchJSON checks route.proto's promise that its field
+// names are the JSON ones: json tags for the output, and the Go field names
+// in snake_case for the echoed RouteInput, which has no tags
+func TestRouteProtoNamesMatchJSON(t *testing.T) {
+	types := map[protoreflect.Name]reflect.Type{
+		"Coordinates":      reflect.TypeOf(Coordinates{}),
+		"Point":            reflect.TypeOf(Point{}),
+		"BoundaryCrossing": reflect.TypeOf(BoundaryCrossing{}),
+		"Instruction":      reflect.TypeOf(Instruction{}),
+		"Bounds":           reflect.TypeOf(Bounds{}),
+		"Address":          reflect.TypeOf(Address{}),
+		"DistanceMarker":   reflect.TypeOf(DistanceMarker{}),
+		"RoutingHandoff":   reflect.TypeOf(RoutingHandoff{}),
+		"Route":            reflect.TypeOf(Route{}),
+		"RouteInput":       reflect.TypeOf(RouteInput{}),
+		"RouteOutput":      reflect.TypeOf(RouteOutput{}),
+	}
+	messages := loadRouteProto(t).Messages()
+	for i := 0; i < messages.Len(); i++ {
+		m := messages.Get(i)
+		typ, ok := types[m.Name()]
+		if !ok {
+			t.Errorf("route.proto message %s has no Go type in this test", m.Name())
+			continue
+		}
+		names := jsonNames(typ)
+		for j := 0; j < m.Fields().Len(); j++ {
+			if f := m.Fields().Get(j); !names[string(f.Name())] {
+				t.Errorf("%s.%s matches no field of %s", m.Name(), f.Name(), typ.Name())
+			}
+		}
+	}
+}
+
+// jsonNames lists a struct's JSON field names, or its Go field names in
+// snake_case when untagged, including those of embedded structs
+func jsonNames(typ reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Anonymous {
+			for name := range jsonNames(f.Type) {
+				names[name] = true
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,249 @@
+package entities
+
+import (
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ContentTypeProtobuf is the Accept/Content-Type value for the binary route form
+const ContentTypeProtobuf = "application/x-protobuf"
+
+// MarshalProto encodes the output as the RouteOutput message in proto/route.proto.
+// Zero values are omitted, as proto3 does.
+func (o RouteOutput) MarshalProto() []byte {
+	var b []byte
+	for _, rt := range o.Routes {
+		b = appendMessage(b, 1, rt.marshalProto())
+	}
+	if o.Request != nil {
+		b = appendMessage(b, 2, o.Request.marshalProto())
+	}
+	return b
+}
+
+// MarshalProto encodes a single route as the Route message, for ?single=true.
+func (r Route) MarshalProto() []byte {
+	return r.marshalProto()
+}
+
+func (r Route) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, r.ID)
+	for _, p := range r.Points {
+		b = appendMessage(b, 2, p.marshalProto())
+	}
+	for _, inst := range r.Instructions {
+		b = appendMessage(b, 3, inst.marshalProto())
+	}
+	if r.DestinationAddress != nil {
+		b = appendMessage(b, 4, r.DestinationAddress.marshalProto())
+	}
+	b = appendString(b, 5, r.GoogleMapsURL)
+	b = appendDouble(b, 6, r.TotalAscentMeters)
+	b = appendDouble(b, 7, r.TotalDescentMeters)
+	b = appendInt(b, 8, r.RawPointCount)
+	b = appendInt(b, 9, r.SimplifiedPointCount)
+	for _, advisory := range r.Advisories {
+		b = appendString(b, 10, advisory)
+	}
+	b = appendInt(b, 11, r.StopCount)
+	b = appendDouble(b, 12, r.EstimatedBatteryUsedWh)
+	if r.BatterySufficient != nil {
+		// optional field: encoded even when false
+		b = protowire.AppendTag(b, 13, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(*r.BatterySufficient))
+	}
+	b = appendInt(b, 14, r.CO2SavedGrams)
+	b = appendString(b, 15, r.Hash)
+	b = appendString(b, 16, r.OverviewPolyline)
+	b = appendString(b, 18, r.Units)
+	b = appendInt(b, 19, r.TotalDistanceMeters)
+	b = appendInt(b, 20, r.TotalDurationSeconds)
+	for _, c := range r.DecodedPolyline {
+		b = appendMessage(b, 17, c.marshalProto())
+	}
+	b = appendMessage(b, 21, r.Bounds.marshalProto())
+	b = appendDouble(b, 22, r.EstimatedCalories)
+	b = appendString(b, 23, r.FallbackMode)
+	if r.Handoff != nil {
+		b = appendMessage(b, 24, r.Handoff.marshalProto())
+	}
+	for _, m := range r.DistanceMarkers {
+		b = appendMessage(b, 25, m.marshalProto())
+	}
+	return b
+}
+
+func (p Point) marshalProto() []byte {
+	var b []byte
+	b = appendDouble(b, 1, p.Lat)
+	b = appendDouble(b, 2, p.Lng)
+	b = appendString(b, 3, p.Description)
+	b = appendString(b, 4, p.NameSource)
+	b = appendString(b, 5, p.PlaceID)
+	b = appendDouble(b, 6, p.Elevation)
+	b = appendBool(b, 7, p.IsDownHill)
+	b = appendBool(b, 8, p.IsIntersection)
+	b = appendDouble(b, 9, p.GradePercent)
+	if p.BoundaryCrossing != nil {
+		b = appendMessage(b, 10, p.BoundaryCrossing.marshalProto())
+	}
+	return b
+}
+
+func (c BoundaryCrossing) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, c.Level)
+	b = appendString(b, 2, c.Name)
+	return b
+}
+
+func (i Instruction) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, i.Instruction)
+	b = appendInt(b, 2, i.DistanceMeters)
+	b = appendInt(b, 3, i.DurationSeconds)
+	b = appendString(b, 4, i.Maneuver)
+	b = appendString(b, 5, i.StreetName)
+	b = appendString(b, 6, i.NameSource)
+	b = appendDouble(b, 7, i.TurnAngle)
+	b = appendString(b, 8, i.TravelMode)
+	b = appendMessage(b, 9, i.StartLocation.marshalProto())
+	b = appendInt(b, 10, i.PointIndex)
+	b = appendString(b, 11, i.AccessibleText)
+	b = appendString(b, 12, i.EstimatedTime)
+	b = appendString(b, 13, i.DistanceText)
+	return b
+}
+
+func (c Coordinates) marshalProto() []byte {
+	var b []byte
+	b = appendDouble(b, 1, c.Lat)
+	b = appendDouble(b, 2, c.Lng)
+	return b
+}
+
+func (m DistanceMarker) marshalProto() []byte {
+	var b []byte
+	b = appendDouble(b, 1, m.Lat)
+	b = appendDouble(b, 2, m.Lng)
+	b = appendInt(b, 3, m.Value)
+	return b
+}
+
+func (h RoutingHandoff) marshalProto() []byte {
+	var b []byte
+	for _, c := range h.Coordinates {
+		b = appendMessage(b, 1, Coordinates{Lat: c[1], Lng: c[0]}.marshalProto())
+	}
+	b = appendString(b, 2, h.Mode)
+	b = appendString(b, 3, h.OSRMProfile)
+	b = appendString(b, 4, h.ValhallaCosting)
+	return b
+}
+
+func (in RouteInput) marshalProto() []byte {
+	var b []byte
+	if in.Origin != nil {
+		b = appendMessage(b, 1, in.Origin.marshalProto())
+	}
+	b = appendString(b, 2, in.OriginAddress)
+	b = appendString(b, 3, in.Destination)
+	if in.DestinationCoords != nil {
+		b = appendMessage(b, 4, in.DestinationCoords.marshalProto())
+	}
+	b = appendString(b, 5, in.Mode)
+	b = appendBool(b, 6, in.TransitFallback)
+	b = appendString(b, 7, in.Units)
+	b = appendString(b, 8, in.Language)
+	for _, wp := range in.Waypoints {
+		b = appendMessage(b, 9, wp.marshalProto())
+	}
+	b = appendBool(b, 10, in.Alternatives)
+	b = appendInt(b, 11, in.Leg)
+	b = appendString(b, 12, in.Verbosity)
+	for _, avoid := range in.Avoid {
+		b = appendString(b, 13, avoid)
+	}
+	b = appendString(b, 14, in.Prefer)
+	b = appendDouble(b, 15, in.PreserveTurnDegrees)
+	b = appendString(b, 16, in.Simplify)
+	b = appendDouble(b, 17, in.SimplifyEpsilonMeters)
+	b = appendDouble(b, 18, in.SimplifyMeters)
+	b = appendDouble(b, 19, in.ZigZagMeters)
+	b = appendDouble(b, 20, in.MaxElevationGainMeters)
+	b = appendDouble(b, 21, in.MaxGradePercent)
+	b = appendDouble(b, 22, in.BatteryWh)
+	b = appendString(b, 23, in.AssistLevel)
+	b = appendDouble(b, 24, in.RiderWeightKg)
+	b = appendDouble(b, 25, in.ElevationSamplesPerKm)
+	b = appendTime(b, 26, in.DepartureTime)
+	b = appendTime(b, 27, in.ArrivalTime)
+	return b
+}
+
+func (bb Bounds) marshalProto() []byte {
+	var b []byte
+	b = appendMessage(b, 1, bb.NorthEast.marshalProto())
+	b = appendMessage(b, 2, bb.SouthWest.marshalProto())
+	return b
+}
+
+func (a Address) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, a.StreetNumber)
+	b = appendString(b, 2, a.Route)
+	b = appendString(b, 3, a.Locality)
+	b = appendString(b, 4, a.AdministrativeArea)
+	b = appendString(b, 5, a.PostalCode)
+	b = appendString(b, 6, a.Country)
+	b = appendString(b, 7, a.CountryCode)
+	b = appendString(b, 8, a.FormattedAddress)
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendInt(b []byte, num protowire.Number, v int) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int64(v)))
+}
+
+func appendTime(b []byte, num protowire.Number, t Timestamp) []byte {
+	if t.IsZero() {
+		return b
+	}
+	return appendString(b, num, t.Format(time.RFC3339Nano))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
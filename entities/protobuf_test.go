@@ -0,0 +1,163 @@
+package entities
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoFields decodes one message level into its fields by number: varints
+// and fixed64s as uint64, length-delimited fields as []byte
+func protoFields(t *testing.T, b []byte) map[protowire.Number][]any {
+	t.Helper()
+	fields := map[protowire.Number][]any{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var v any
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("field %d: unexpected wire type %d", num, typ)
+		}
+		if n < 0 {
+			t.Fatalf("field %d: %v", num, protowire.ParseError(n))
+		}
+		fields[num] = append(fields[num], v)
+		b = b[n:]
+	}
+	return fields
+}
+
+// testRouteOutput sets every field route.proto describes
+func testRouteOutput() RouteOutput {
+	sufficient := true
+	departure := time.Date(2026, 5, 1, 8, 30, 0, 0, time.UTC)
+	return RouteOutput{
+		Routes: []Route{{
+			ID: 1,
+			Points: []Point{
+				{Lat: 37.7749, Lng: -122.4194, Description: "Market St", NameSource: NameSourceReverseGeocode, PlaceID: "p1", Elevation: 16, IsDownHill: true, IsIntersection: true, GradePercent: -2.5},
+				{Lat: 37.8, Lng: -122.4, Description: "Oakland", Elevation: 3, BoundaryCrossing: &BoundaryCrossing{Level: "locality", Name: "Oakland"}},
+			},
+			Instructions: []Instruction{{
+				Instruction: "Turn <b>right</b>", DistanceMeters: 120, DurationSeconds: 30, Maneuver: "turn-right",
+				StreetName: "Valencia St", NameSource: NameSourceManeuverHTML, TurnAngle: 90, TravelMode: "bicycling",
+				StartLocation: Coordinates{Lat: 37.7759, Lng: -122.4194}, PointIndex: 1, AccessibleText: "Turn right",
+				EstimatedTime: "2026-05-01T08:30:30Z", DistanceText: "120 m",
+			}},
+			DestinationAddress: &Address{StreetNumber: "1", Route: "Ferry Building", Locality: "San Francisco", AdministrativeArea: "CA",
+				PostalCode: "94111", Country: "United States", CountryCode: "US", FormattedAddress: "1 Ferry Building"},
+			GoogleMapsURL:          "https://www.google.com/maps/dir/?api=1",
+			TotalDistanceMeters:    3200,
+			TotalDurationSeconds:   900,
+			TotalAscentMeters:      12.5,
+			TotalDescentMeters:     25,
+			Advisories:             []string{"Headwind"},
+			StopCount:              4,
+			Handoff:                &RoutingHandoff{Coordinates: [][2]float64{{-122.4194, 37.7749}, {-122.4, 37.8}}, Mode: "bicycling", OSRMProfile: "bike", ValhallaCosting: "bicycle"},
+			DistanceMarkers:        []DistanceMarker{{Coordinates: Coordinates{Lat: 37.78, Lng: -122.41}, Value: 1}},
+			CO2SavedGrams:          352,
+			EstimatedCalories:      95,
+			Hash:                   "abc",
+			Units:                  "metric",
+			OverviewPolyline:       "_p~iF~ps|U",
+			DecodedPolyline:        []Coordinates{{Lat: 37.7749, Lng: -122.4194}},
+			Bounds:                 Bounds{NorthEast: Coordinates{Lat: 37.8, Lng: -122.4}, SouthWest: Coordinates{Lat: 37.7749, Lng: -122.4194}},
+			FallbackMode:           "walking",
+			EstimatedBatteryUsedWh: 42,
+			BatterySufficient:      &sufficient,
+			RawPointCount:          10,
+			SimplifiedPointCount:   2,
+		}},
+		Request: &RouteInput{
+			Origin: &Coordinates{Lat: 37.7749, Lng: -122.4194}, OriginAddress: "Mission", Destination: "Ferry Building",
+			DestinationCoords: &Coordinates{Lat: 37.7955, Lng: -122.3937}, Mode: "transit", TransitFallback: true,
+			Units: "metric", Language: "en", Waypoints: []Coordinates{{Lat: 37.78, Lng: -122.41}}, Alternatives: true,
+			Leg: 1, Verbosity: VerbosityVerbose, Avoid: []string{"tolls", "unpaved"}, Prefer: "bikelanes",
+			PreserveTurnDegrees: 45, Simplify: "douglas-peucker", SimplifyEpsilonMeters: 10, SimplifyMeters: 50,
+			ZigZagMeters: 30, MaxElevationGainMeters: 500, MaxGradePercent: 8, BatteryWh: 500, AssistLevel: "eco",
+			RiderWeightKg: 70, ElevationSamplesPerKm: 20,
+			DepartureTime: Timestamp{departure}, ArrivalTime: Timestamp{departure.Add(time.Hour)},
+		},
+	}
+}
+
+func TestMarshalProto(t *testing.T) {
+	out := testRouteOutput()
+	top := protoFields(t, out.MarshalProto())
+	if len(top[1]) != 1 || len(top[2]) != 1 {
+		t.Fatalf("RouteOutput has %d routes and %d requests, want 1 and 1", len(top[1]), len(top[2]))
+	}
+	route := protoFields(t, top[1][0].([]byte))
+
+	double := func(v any) float64 { return math.Float64frombits(v.(uint64)) }
+	str := func(v any) string { return string(v.([]byte)) }
+
+	handoff := protoFields(t, route[24][0].([]byte))
+	if got := len(handoff[1]); got != 2 {
+		t.Errorf("handoff has %d coordinates, want 2", got)
+	}
+	first := protoFields(t, handoff[1][0].([]byte))
+	if lat, lng := double(first[1][0]), double(first[2][0]); lat != 37.7749 || lng != -122.4194 {
+		t.Errorf("handoff origin = %v,%v, want lat 37.7749, lng -122.4194", lat, lng)
+	}
+	if got := str(handoff[3][0]); got != "bike" {
+		t.Errorf("handoff osrm_profile = %q, want bike", got)
+	}
+
+	marker := protoFields(t, route[25][0].([]byte))
+	if got := marker[3][0].(uint64); got != 1 {
+		t.Errorf("distance marker value = %d, want 1", got)
+	}
+
+	points := route[2]
+	if len(points) != 2 {
+		t.Fatalf("%d points, want 2", len(points))
+	}
+	if _, ok := protoFields(t, points[0].([]byte))[10]; ok {
+		t.Error("first point has a boundary crossing")
+	}
+	crossing := protoFields(t, protoFields(t, points[1].([]byte))[10][0].([]byte))
+	if level, name := str(crossing[1][0]), str(crossing[2][0]); level != "locality" || name != "Oakland" {
+		t.Errorf("boundary crossing = %s %s, want locality Oakland", level, name)
+	}
+
+	if got := str(route[23][0]); got != "walking" {
+		t.Errorf("fallback_mode = %q, want walking", got)
+	}
+
+	request := protoFields(t, top[2][0].([]byte))
+	if got := str(request[5][0]); got != "transit" {
+		t.Errorf("request mode = %q, want transit", got)
+	}
+	if got := len(request[13]); got != 2 {
+		t.Errorf("request has %d avoid values, want 2", got)
+	}
+	if got := str(request[26][0]); got != "2026-05-01T08:30:00Z" {
+		t.Errorf("request departure_time = %q", got)
+	}
+}
+
+func TestMarshalProtoOmitsUnset(t *testing.T) {
+	top := protoFields(t, RouteOutput{Routes: []Route{{ID: 1}}}.MarshalProto())
+	if _, ok := top[2]; ok {
+		t.Error("request encoded without ?echo=true")
+	}
+	route := protoFields(t, top[1][0].([]byte))
+	for _, num := range []protowire.Number{13, 23, 24, 25} {
+		if _, ok := route[num]; ok {
+			t.Errorf("unset route field %d was encoded", num)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bike-router/entities"
+	"bike-router/router"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// writeError sends the JSON error body every handler uses
+func writeError(w http.ResponseWriter, status int, code entities.ErrorCode, message string) {
+	if rec, ok := w.(*statusRecorder); ok {
+		rec.err = message
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(entities.ErrorResponse{Error: message, Code: code})
+}
+
+// statusClientClosedRequest is nginx's non-standard status for a client that
+// went away before the response; it only ever shows up in logs
+const statusClientClosedRequest = 499
+
+// writeContextError reports a request abandoned mid-processing: 504 when the
+// request's deadline passed, 499 when the client disconnected
+func writeContextError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, entities.CodeTimeout, "request timed out")
+		return
+	}
+	writeError(w, statusClientClosedRequest, entities.CodeCanceled, "request canceled")
+}
+
+// writeRouteError reports a failed router call: the request's own deadline or
+// cancellation first, then the router's error kinds
+func writeRouteError(w http.ResponseWriter, ctx context.Context, err error) {
+	var inputErr router.InputError
+	var noMatch router.NoMatchingRouteError
+	switch {
+	case ctx.Err() != nil:
+		writeContextError(w, ctx.Err())
+	case errors.As(err, &inputErr):
+		writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, err.Error())
+	case errors.Is(err, router.ErrNoRoutes):
+		writeError(w, http.StatusNotFound, entities.CodeNoRoutes, err.Error())
+	case errors.As(err, &noMatch):
+		writeError(w, http.StatusUnprocessableEntity, entities.CodeNoMatchingRoute, err.Error())
+	case router.IsRateLimited(err):
+		writeError(w, http.StatusServiceUnavailable, entities.CodeRateLimited, "maps rate limit exceeded, try again later")
+	default:
+		code := router.UpstreamErrorCode(err)
+		writeError(w, upstreamStatus[code], code, err.Error())
+	}
+}
+
+// upstreamStatus is the response status for each kind of failed Maps call.
+// Failures on Google's side or with the server's key are 502, not the
+// client's fault; a quota that ran out is 429 so clients back off.
+var upstreamStatus = map[entities.ErrorCode]int{
+	entities.CodeTimeout:         http.StatusGatewayTimeout,
+	entities.CodeOverQuota:       http.StatusTooManyRequests,
+	entities.CodeUpstreamDenied:  http.StatusBadGateway,
+	entities.CodeAddressNotFound: http.StatusNotFound,
+	entities.CodeInvalidRequest:  http.StatusBadRequest,
+	entities.CodeUpstream:        http.StatusBadGateway,
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bike-router/entities"
+	"bike-router/router"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteRouteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   entities.ErrorCode
+	}{
+		{"invalid input", router.InputError("bad"), http.StatusBadRequest, entities.CodeInvalidRequest},
+		{"no routes", router.ErrNoRoutes, http.StatusNotFound, entities.CodeNoRoutes},
+		{"no matching route", router.NoMatchingRouteError("too steep"), http.StatusUnprocessableEntity, entities.CodeNoMatchingRoute},
+		{"address not found", &router.DirectionsError{Err: errors.New("maps: NOT_FOUND - ")}, http.StatusNotFound, entities.CodeAddressNotFound},
+		{"over quota", &router.DirectionsError{Err: errors.New("maps: OVER_QUERY_LIMIT - ")}, http.StatusTooManyRequests, entities.CodeOverQuota},
+		{"invalid key", &router.DirectionsError{Err: errors.New("maps: REQUEST_DENIED - The provided API key is invalid.")}, http.StatusBadGateway, entities.CodeUpstreamDenied},
+		{"billing", &router.DirectionsError{Err: errors.New("maps: OVER_DAILY_LIMIT - ")}, http.StatusBadGateway, entities.CodeUpstreamDenied},
+		{"rejected by Google", &router.DirectionsError{Err: errors.New("maps: INVALID_REQUEST - ")}, http.StatusBadRequest, entities.CodeInvalidRequest},
+		{"maps call timed out", &router.DirectionsError{Err: context.DeadlineExceeded}, http.StatusGatewayTimeout, entities.CodeTimeout},
+		{"other upstream failure", &router.DirectionsError{Err: errors.New("maps: UNKNOWN_ERROR - ")}, http.StatusBadGateway, entities.CodeUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeRouteError(w, t.Context(), tt.err)
+			assertErrorResponse(t, w, tt.status, tt.code)
+		})
+	}
+}
+
+func TestWriteRouteErrorRequestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	w := httptest.NewRecorder()
+	writeRouteError(w, ctx, router.ErrNoRoutes)
+	assertErrorResponse(t, w, statusClientClosedRequest, entities.CodeCanceled)
+
+	ctx, cancel = context.WithTimeout(t.Context(), 0)
+	defer cancel()
+	<-ctx.Done()
+	w = httptest.NewRecorder()
+	writeRouteError(w, ctx, &router.DirectionsError{Err: context.DeadlineExceeded})
+	assertErrorResponse(t, w, http.StatusGatewayTimeout, entities.CodeTimeout)
+}
+
+// assertErrorResponse checks the status and that the body is the JSON error
+// envelope with the given code
+func assertErrorResponse(t *testing.T, w *httptest.ResponseRecorder, status int, code entities.ErrorCode) {
+	t.Helper()
+	if w.Code != status {
+		t.Errorf("status = %d, want %d", w.Code, status)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body entities.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not JSON: %v", w.Body, err)
+	}
+	if body.Code != code || body.Error == "" {
+		t.Errorf("body = %+v, want code %q and a message", body, code)
+	}
+}
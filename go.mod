@@ -3,15 +3,16 @@ module bike-router
 go 1.24.2
 
 require (
+	github.com/joho/godotenv v1.5.1
 	github.com/kr/pretty v0.3.1
+	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1
+	google.golang.org/protobuf v1.36.9
 	googlemaps.github.io/maps v1.7.0
 )
 
 require (
 	github.com/google/uuid v1.1.1 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/rogpeppe/go-internal v1.14.1 // indirect
 	go.opencensus.io v0.22.3 // indirect
-	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1 // indirect
 )
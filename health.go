@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bike-router/entities"
+	"bike-router/router"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// healthHandler is the liveness probe: the process is up and serving. Maps
+// key state belongs to readyHandler, so a key over quota never gets the
+// process restarted.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, entities.CodeMethodNotAllowed, "only GET allowed")
+		return
+	}
+	writeHealth(w, http.StatusOK, "ok")
+}
+
+// readyHandler is the readiness probe: the server isn't shutting down and at
+// least one API key isn't cooling down after going over quota. keyStatus
+// reports the keys (router.KeyStatus); only local state is checked, so probes
+// never spend Maps quota.
+func readyHandler(keyStatus func() (usable, total int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, entities.CodeMethodNotAllowed, "only GET allowed")
+			return
+		}
+		if shuttingDown.Load() {
+			writeHealth(w, http.StatusServiceUnavailable, "shutting down")
+			return
+		}
+		if usable, total := keyStatus(); usable == 0 {
+			writeHealth(w, http.StatusServiceUnavailable, fmt.Sprintf("all %d maps API keys over quota", total))
+			return
+		}
+		writeHealth(w, http.StatusOK, "ok")
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(entities.HealthResponse{Status: message})
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, entities.CodeMethodNotAllowed, "only GET allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entities.MetricsOutput{Caches: router.CacheStats()})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bike-router/entities"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		shuttingDown bool
+		wantStatus   int
+		wantBody     string
+	}{
+		{"alive", http.MethodGet, false, http.StatusOK, "ok"},
+		{"alive while draining", http.MethodGet, true, http.StatusOK, "ok"},
+		{"wrong method", http.MethodPost, false, http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shuttingDown.Store(tt.shuttingDown)
+			t.Cleanup(func() { shuttingDown.Store(false) })
+
+			w := httptest.NewRecorder()
+			healthHandler(w, httptest.NewRequest(tt.method, "/health", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			var body entities.HealthResponse
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Status != tt.wantBody {
+				t.Errorf("status message = %q, want %q", body.Status, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		shuttingDown bool
+		usable       int
+		wantStatus   int
+		wantMessage  string
+	}{
+		{"ready", false, 2, http.StatusOK, "ok"},
+		{"one key left", false, 1, http.StatusOK, "ok"},
+		{"draining", true, 2, http.StatusServiceUnavailable, "shutting down"},
+		{"every key benched", false, 0, http.StatusServiceUnavailable, "all 2 maps API keys over quota"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shuttingDown.Store(tt.shuttingDown)
+			t.Cleanup(func() { shuttingDown.Store(false) })
+
+			handler := readyHandler(func() (int, int) { return tt.usable, 2 })
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var body entities.HealthResponse
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Status != tt.wantMessage {
+				t.Errorf("status message = %q, want %q", body.Status, tt.wantMessage)
+			}
+		})
+	}
+}
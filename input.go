@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bike-router/entities"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// utf8BOM is the byte order mark some Windows clients put before the JSON
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodeJSONBody decodes a single JSON value from a request body. A leading
+// UTF-8 BOM is skipped; anything but whitespace after the value is an error
+// rather than being silently ignored.
+func decodeJSONBody(body io.Reader, v any) error {
+	br := bufio.NewReader(body)
+	if prefix, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(prefix, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	dec := json.NewDecoder(br)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+	// More reports false for a stray closing bracket; make sure nothing is left
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// routeInputFromQuery builds a RouteInput from GET /route query parameters:
+// origin and waypoints as "lat,lng" (waypoints separated by "|"), destination
+// as an address or "lat,lng", plus mode, units, language, verbosity and
+// alternatives.
+// Fields left out get the same defaults as a POST body that omits them.
+func routeInputFromQuery(q url.Values) (entities.RouteInput, error) {
+	req := entities.RouteInput{
+		OriginAddress: q.Get("originAddress"),
+		Destination:   q.Get("destination"),
+		Mode:          q.Get("mode"),
+		Units:         q.Get("units"),
+		Language:      q.Get("language"),
+		Verbosity:     q.Get("verbosity"),
+		Alternatives:  q.Get("alternatives") == "true",
+	}
+	if v := q.Get("origin"); v != "" {
+		c, err := parseLatLng(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid origin: %w", err)
+		}
+		req.Origin = &c
+	}
+	if v := q.Get("waypoints"); v != "" {
+		for _, wp := range strings.Split(v, "|") {
+			c, err := parseLatLng(wp)
+			if err != nil {
+				return req, fmt.Errorf("invalid waypoint %q: %w", wp, err)
+			}
+			req.Waypoints = append(req.Waypoints, c)
+		}
+	}
+	return req, nil
+}
+
+// parseLatLng parses a "lat,lng" pair, rejecting values off the globe
+func parseLatLng(s string) (entities.Coordinates, error) {
+	latStr, lngStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return entities.Coordinates{}, errors.New(`want "lat,lng"`)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil {
+		return entities.Coordinates{}, fmt.Errorf("latitude %q must be a number between -90 and 90", latStr)
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(lngStr), 64)
+	if err != nil {
+		return entities.Coordinates{}, fmt.Errorf("longitude %q must be a number between -180 and 180", lngStr)
+	}
+	c := entities.Coordinates{Lat: lat, Lng: lng}
+	return c, c.Validate()
+}
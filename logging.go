@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bike-router/utils"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// requestFields are the request details a handler adds to its log line
+type requestFields struct {
+	Origin      string
+	Destination string
+	Routes      int
+}
+
+type requestFieldsKey struct{}
+
+// logFields returns the log fields of the current request, or a throwaway
+// value outside withRequestLog
+func logFields(ctx context.Context) *requestFields {
+	if f, ok := ctx.Value(requestFieldsKey{}).(*requestFields); ok {
+		return f
+	}
+	return &requestFields{}
+}
+
+// statusRecorder remembers the status and error message a handler sent
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	err    string
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// requestIDHeader carries the request ID: a client may send its own to match
+// its logs with the server's, and every response echoes the one used
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds a client-supplied request ID
+const maxRequestIDLength = 128
+
+// requestID returns the client's X-Request-ID when it is safe to log and echo
+// (letters, digits, '-', '_', '.' and ':'), or else a new random UUID
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= maxRequestIDLength && isRequestIDSafe(id) {
+		return id
+	}
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func isRequestIDSafe(id string) bool {
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.:", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID gives every request an ID, set on the response and on every
+// record logged with the request's context
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r)
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(utils.WithRequestID(r.Context(), id)))
+	})
+}
+
+// withRequestLog emits one JSON log line per request, which also drives the
+// ntfy notification for it. 5xx responses log as errors, 4xx as warnings;
+// every line notifies unless NOTIFY_LEVEL is raised.
+func withRequestLog(component string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		fields := &requestFields{}
+		next(rec, r.WithContext(context.WithValue(r.Context(), requestFieldsKey{}, fields)))
+
+		attrs := []any{
+			utils.NotifyKey, component,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"latency_ms", time.Since(start).Milliseconds(),
+		}
+		if fields.Origin != "" || fields.Destination != "" {
+			attrs = append(attrs, "origin", fields.Origin, "destination", fields.Destination, "routes", fields.Routes)
+		}
+		if rec.err != "" {
+			attrs = append(attrs, "error", rec.err)
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.Log(r.Context(), level, "request", attrs...)
+	}
+}
+
+// notifyFlushTimeout bounds how long exiting waits for queued notifications
+const notifyFlushTimeout = 5 * time.Second
+
+// fatal logs a startup failure, notifying ntfy, and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, utils.NotifyKey, "Main", "error", err.Error())
+	utils.FlushNotifications(notifyFlushTimeout)
+	os.Exit(1)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bike-router/utils"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestWithRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		sent   string
+		wantID string // "" means a generated UUID
+	}{
+		{"echoes the client's ID", "client-42:retry.1", "client-42:retry.1"},
+		{"generates one when missing", "", ""},
+		{"generates one for unsafe characters", "bad id\n", ""},
+		{"generates one for a long ID", strings.Repeat("a", maxRequestIDLength+1), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = utils.RequestID(r.Context())
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/nowhere", nil)
+			if tt.sent != "" {
+				r.Header.Set(requestIDHeader, tt.sent)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			got := w.Header().Get(requestIDHeader)
+			if got != seen {
+				t.Errorf("response ID %q, handler saw %q", got, seen)
+			}
+			switch {
+			case tt.wantID != "" && got != tt.wantID:
+				t.Errorf("ID = %q, want %q", got, tt.wantID)
+			case tt.wantID == "" && !uuidPattern.MatchString(got):
+				t.Errorf("ID = %q, want a random UUID", got)
+			}
+		})
+	}
+}
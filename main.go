@@ -2,362 +2,272 @@ package main
 
 import (
 	"bike-router/entities"
+	"bike-router/router"
 	"bike-router/utils"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"math"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	maps "googlemaps.github.io/maps"
 )
 
 func main() {
+	slog.SetDefault(utils.NewLogger(os.Stdout))
 
-	apiKey := utils.LoadConfig()
+	cfg := utils.LoadConfig()
+	utils.ConfigureNotifications(cfg)
 
-	client, err := maps.NewClient(maps.WithAPIKey(apiKey))
-	if err != nil {
-		message := utils.FormatErrorNotification(fmt.Errorf("maps.NewClient: %v", err), "Main")
-		utils.SendNotification(message)
-		log.Fatalf("maps.NewClient: %v", err)
+	// One client per key, sharing the rate limit and connections
+	httpClient := &http.Client{Transport: router.Transport(cfg)}
+	mapsClients := make([]*maps.Client, 0, len(cfg.GoogleMapsAPIKeys))
+	for _, key := range cfg.GoogleMapsAPIKeys {
+		mapsClient, err := maps.NewClient(maps.WithAPIKey(key), maps.WithHTTPClient(httpClient))
+		if err != nil {
+			fatal("maps.NewClient failed", err)
+		}
+		mapsClients = append(mapsClients, mapsClient)
 	}
+	client := router.NewMapsClient(mapsClients...)
 
-	http.HandleFunc("/route", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			message := utils.FormatErrorNotification(fmt.Errorf("invalid method: %s", r.Method), "Route Handler")
-			utils.SendNotification(message)
-			http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	if err := router.Configure(cfg); err != nil {
+		fatal("router.Configure failed", err)
+	}
 
-		var req entities.RouteInput
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			message := utils.FormatErrorNotification(fmt.Errorf("invalid json: %v", err), "Route Handler")
-			utils.SendNotification(message)
-			http.Error(w, "invalid json", http.StatusBadRequest)
-			return
+	if cfg.RecordRequestsFile != "" {
+		var err error
+		requestLog, err = newRequestRecorder(cfg.RecordRequestsFile)
+		if err != nil {
+			fatal("newRequestRecorder failed", err)
 		}
+	}
 
-		originStr := fmt.Sprintf("%f,%f", req.Origin.Lat, req.Origin.Lng)
-		dr := &maps.DirectionsRequest{
-			Origin:      originStr,
-			Destination: req.Destination,
-			Mode:        maps.TravelModeWalking, // Changed from Bicycling for better pedestrian path accuracy
-		}
+	if len(cfg.WarmupLocations) > 0 {
+		go router.WarmCaches(client, cfg.WarmupLocations)
+	}
 
-		routesResp, _, err := client.Directions(context.Background(), dr)
-		if err != nil {
-			message := utils.FormatErrorNotification(fmt.Errorf("directions error: %v", err), "Route Handler")
-			utils.SendNotification(message)
-			http.Error(w, "directions error: "+err.Error(), http.StatusInternalServerError)
+	http.HandleFunc("/route", withRequestLog("Route Handler", func(w http.ResponseWriter, r *http.Request) {
+		var req entities.RouteInput
+		switch r.Method {
+		case http.MethodPost:
+			if err := decodeJSONBody(r.Body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, entities.CodeInvalidJSON, "invalid json: "+err.Error())
+				return
+			}
+		case http.MethodGet:
+			var err error
+			if req, err = routeInputFromQuery(r.URL.Query()); err != nil {
+				writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, err.Error())
+				return
+			}
+		default:
+			writeError(w, http.StatusMethodNotAllowed, entities.CodeMethodNotAllowed, "only GET and POST allowed")
 			return
 		}
 
-		if len(routesResp) == 0 {
-			http.Error(w, "no routes", http.StatusNotFound)
+		if err := router.Validate(req); err != nil {
+			writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, err.Error())
 			return
 		}
 
-		out := entities.RouteOutput{Routes: make([]entities.Route, 0, len(routesResp))}
-		for i, rt := range routesResp {
-			route := entities.Route{ID: i + 1}
-			points := []entities.Point{}
-			instructions := []entities.Instruction{}
-			
-			cumulativeDistance := 0
-			cumulativeTime := 0
-
-			for _, leg := range rt.Legs {
-				var lastDesc string
-				for _, step := range leg.Steps {
-					lat := step.StartLocation.Lat
-					lng := step.StartLocation.Lng
-
-					// Extract instruction from Google
-					htmlInst := step.HTMLInstructions
-					distanceMeters := step.Distance.Meters
-					durationSecs := int(step.Duration.Seconds())
-					
-					// Extract street name from HTML instruction
-					streetName := extractStreetNameFromHTML(htmlInst)
-					if streetName == "" {
-						streetName = stripHTML(htmlInst)
-					}
-					
-					// Build instruction object
-					instruction := entities.Instruction{
-						Instruction:     htmlInst,
-						DistanceMeters:  cumulativeDistance,
-						DurationSeconds: cumulativeTime,
-						Maneuver:        "", // Google Maps Go library doesn't expose maneuver field
-						StreetName:      streetName,
-						StartLocation:   entities.Coordinates{Lat: lat, Lng: lng},
-					}
-					instructions = append(instructions, instruction)
-					
-					cumulativeDistance += distanceMeters
-					cumulativeTime += durationSecs
-
-					// Prefer clean street name from reverse geocode
-					desc := extractStreetNameFromReverseGeocode(client, lat, lng)
-					if desc == "" {
-						desc = stripHTML(step.HTMLInstructions)
-					}
-
-					// Skip repeated or empty street names
-					if desc == "" || desc == lastDesc {
-						continue
-					}
-					lastDesc = desc
-
-					elev, err := getElevation(client, lat, lng)
-					if err != nil {
-						elev = 0
-					}
-
-					points = append(points, entities.Point{
-						Lat:         lat,
-						Lng:         lng,
-						Description: desc,
-						Elevation:   elev,
-						IsDownHill:  false,
-					})
-				}
+		if requestLog != nil {
+			if err := requestLog.Record(req, r.URL.RawQuery); err != nil {
+				slog.WarnContext(r.Context(), "recording request failed", "error", err.Error())
+			}
+		}
+		router.ApplyDefaults(&req)
 
-				// Add final destination instruction
-				endLat := leg.EndLocation.Lat
-				endLng := leg.EndLocation.Lng
-				endDesc := extractStreetNameFromReverseGeocode(client, endLat, endLng)
-				if endDesc == "" {
-					endDesc = "Destination"
-				}
-				
-				instructions = append(instructions, entities.Instruction{
-					Instruction:     "Arrive at " + endDesc,
-					DistanceMeters:  cumulativeDistance,
-					DurationSeconds: cumulativeTime,
-					Maneuver:        "arrive",
-					StreetName:      endDesc,
-					StartLocation:   entities.Coordinates{Lat: endLat, Lng: endLng},
-				})
-				
-				// Add final leg point
-				elev, err := getElevation(client, endLat, endLng)
-				if err != nil {
-					elev = 0
-				}
-				points = append(points, entities.Point{
-					Lat:         endLat,
-					Lng:         endLng,
-					Description: endDesc,
-					Elevation:   elev,
-					IsDownHill:  false,
-				})
+		opts := router.Options{
+			Debug:      r.URL.Query().Get("debug") == "true",
+			Handoff:    r.URL.Query().Get("handoff") == "true",
+			Boundaries: r.URL.Query().Get("boundaries") == "true",
+			Decoded:    r.URL.Query().Get("decoded") == "true",
+		}
+		if v := r.URL.Query().Get("maxSegment"); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < router.MinMaxSegmentMeters {
+				writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, fmt.Sprintf("maxSegment must be a number of meters, at least %g", router.MinMaxSegmentMeters))
+				return
 			}
+			opts.MaxSegmentMeters = n
+		}
 
-			// Step 1: simplify close points (<50 m)
-			simplified := simplifyRoute(points, 50.0)
+		switch responseFormat(r) {
+		case formatJSON, formatProtobuf, formatGPX, formatGeoJSON:
+		default:
+			writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, "invalid format: must be json, protobuf, gpx or geojson")
+			return
+		}
 
-			// Step 2: remove micro backtracks or “zig-zags”
-			simplified = removeZigZags(simplified, 30.0)
+		fields := logFields(r.Context())
+		fields.Origin, fields.Destination = router.Endpoints(req)
 
-			// Step 3: merge duplicates
-			simplified = mergeDuplicateDescriptions(simplified)
+		// Every Maps call for this request shares its deadline and is
+		// abandoned when the client goes away
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RequestTimeout)
+		defer cancel()
 
-			// Step 4: set downhill info
-			for j := 0; j < len(simplified)-1; j++ {
-				if simplified[j+1].Elevation < simplified[j].Elevation {
-					simplified[j].IsDownHill = true
-				}
+		if r.URL.Query().Get("summary") == "true" {
+			summaries, err := router.Summarize(ctx, client, req)
+			if err != nil {
+				writeRouteError(w, ctx, err)
+				return
 			}
-
-			route.Points = simplified
-			route.Instructions = instructions
-			out.Routes = append(out.Routes, route)
+			fields.Routes = len(summaries.Routes)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(summaries)
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(out)
-
-		message := utils.FormatInfoNotification(
-			fmt.Sprintf("Route request processed: Origin=%s, Destination=%s, RoutesFound=%d", originStr, req.Destination, len(out.Routes)),
-			"Route Handler",
-		)
-		utils.SendNotification(message)
-	})
-
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
+		out, err := router.BuildRoute(ctx, client, req, opts)
+		if err != nil {
+			writeRouteError(w, ctx, err)
+			return
+		}
 
-// =======================
-// Utility Helper Functions
-// =======================
+		fields.Routes = len(out.Routes)
+		if r.URL.Query().Get("echo") == "true" {
+			out.Request = &req
+		}
 
-// getElevation fetches elevation in meters for a given lat/lng
-func getElevation(client *maps.Client, lat, lng float64) (float64, error) {
-	resp, err := client.Elevation(context.Background(), &maps.ElevationRequest{
-		Locations: []maps.LatLng{{Lat: lat, Lng: lng}},
-	})
-	if err != nil || len(resp) == 0 {
-		return 0, err
-	}
-	return resp[0].Elevation, nil
-}
+		// ?single=true drops the wrapper for clients that only ever expect one route
+		if r.URL.Query().Get("single") == "true" {
+			if len(out.Routes) != 1 {
+				writeError(w, http.StatusUnprocessableEntity, entities.CodeMultipleRoutes, fmt.Sprintf("single=true but %d routes were found", len(out.Routes)))
+				return
+			}
+			writeRouteOutput(w, r, out.Routes[0])
+			return
+		}
 
-// extractStreetNameFromReverseGeocode tries to get a clean street name
-// and ignores Plus Codes or generic placeholders.
-func extractStreetNameFromReverseGeocode(client *maps.Client, lat, lng float64) string {
-	resp, err := client.ReverseGeocode(context.Background(), &maps.GeocodingRequest{
-		LatLng: &maps.LatLng{Lat: lat, Lng: lng},
+		writeRouteOutput(w, r, out)
+	}))
+
+	http.HandleFunc("/merge", withRequestLog("Merge Handler", mergeHandler))
+	http.HandleFunc("/reachability", withRequestLog("Reachability Handler", reachabilityHandler))
+	http.HandleFunc("/elevation", withRequestLog("Elevation Handler", elevationHandler(client, cfg.RequestTimeout)))
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/ready", readyHandler(func() (int, int) { return router.KeyStatus(client) }))
+	// Unknown paths get the JSON error body too, not the mux's plain-text 404
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, entities.CodeNotFound, "no such endpoint: "+r.URL.Path)
 	})
-	if err != nil || len(resp) == 0 {
-		return ""
-	}
 
-	for _, comp := range resp[0].AddressComponents {
-		for _, t := range comp.Types {
-			if t == "route" {
-				name := comp.LongName
-				if strings.Contains(name, "+") || strings.HasPrefix(name, "Unnamed") {
-					return ""
-				}
-				return name
-			}
-		}
+	server := newServer(cfg, withRequestID(http.DefaultServeMux))
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		fatal("listen failed", err)
 	}
-
-	formatted := resp[0].FormattedAddress
-	if strings.Contains(formatted, "+") || strings.Contains(formatted, "Unnamed") {
-		return ""
+	// A second signal during the drain kills the process at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	if err := serve(ctx, server, ln, cfg.ShutdownTimeout); err != nil {
+		fatal("server stopped", err)
 	}
-	return formatted
+	utils.FlushNotifications(notifyFlushTimeout)
 }
 
-func stripHTML(s string) string {
-	out := make([]rune, 0, len(s))
-	inTag := false
-	for _, r := range s {
-		if r == '<' {
-			inTag = true
-			continue
-		}
-		if r == '>' {
-			inTag = false
-			continue
-		}
-		if !inTag {
-			out = append(out, r)
-		}
-	}
-	return strings.TrimSpace(string(out))
-}
+// Response formats for /route
+const (
+	formatJSON     = "json"
+	formatProtobuf = "protobuf"
+	formatGPX      = "gpx"
+	formatGeoJSON  = "geojson"
+)
 
-// extractStreetNameFromHTML parses street name from Google HTML instructions
-// e.g., "Turn <b>left</b> onto <b>Market St</b>" -> "Market St"
-func extractStreetNameFromHTML(html string) string {
-	// Look for text in <b> tags that comes after "onto" or "on"
-	lower := strings.ToLower(html)
-	
-	if idx := strings.Index(lower, " onto "); idx >= 0 {
-		after := html[idx+6:]
-		// Find first <b>...</b> after "onto"
-		if start := strings.Index(after, "<b>"); start >= 0 {
-			after = after[start+3:]
-			if end := strings.Index(after, "</b>"); end >= 0 {
-				return strings.TrimSpace(after[:end])
-			}
-		}
+// responseFormat picks the /route response format: ?format= wins over the
+// Accept header, and JSON is the default
+func responseFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
 	}
-	
-	if idx := strings.Index(lower, " on "); idx >= 0 {
-		after := html[idx+4:]
-		if start := strings.Index(after, "<b>"); start >= 0 {
-			after = after[start+3:]
-			if end := strings.Index(after, "</b>"); end >= 0 {
-				return strings.TrimSpace(after[:end])
-			}
-		}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, entities.ContentTypeProtobuf):
+		return formatProtobuf
+	case strings.Contains(accept, entities.ContentTypeGPX):
+		return formatGPX
+	case strings.Contains(accept, entities.ContentTypeGeoJSON):
+		return formatGeoJSON
+	default:
+		return formatJSON
 	}
-	
-	// Fallback: strip all HTML and return
-	return stripHTML(html)
 }
 
-// simplifyRoute removes points that are too close together (< minDist meters)
-func simplifyRoute(points []entities.Point, minDist float64) []entities.Point {
-	if len(points) <= 2 {
-		return points
-	}
-
-	simplified := []entities.Point{points[0]} // keep first
-	for i := 1; i < len(points)-1; i++ {
-		last := simplified[len(simplified)-1]
-		curr := points[i]
-		dist := haversine(last.Lat, last.Lng, curr.Lat, curr.Lng)
-		if dist >= minDist {
-			simplified = append(simplified, curr)
-		}
-	}
-	simplified = append(simplified, points[len(points)-1])
-	return simplified
+// routeEncoder is implemented by both RouteOutput and a bare Route (?single=true)
+type routeEncoder interface {
+	MarshalProto() []byte
+	MarshalGPX() []byte
+	MarshalGeoJSON() []byte
 }
 
-// removeZigZags removes small “back-and-forth” hops (<minBacktrack meters)
-func removeZigZags(points []entities.Point, minBacktrack float64) []entities.Point {
-	if len(points) < 3 {
-		return points
+// writeRouteOutput serializes a route response in the negotiated format
+func writeRouteOutput(w http.ResponseWriter, r *http.Request, v routeEncoder) {
+	switch responseFormat(r) {
+	case formatProtobuf:
+		w.Header().Set("Content-Type", entities.ContentTypeProtobuf)
+		_, _ = w.Write(v.MarshalProto())
+	case formatGPX:
+		w.Header().Set("Content-Type", entities.ContentTypeGPX)
+		_, _ = w.Write(v.MarshalGPX())
+	case formatGeoJSON:
+		w.Header().Set("Content-Type", entities.ContentTypeGeoJSON)
+		_, _ = w.Write(v.MarshalGeoJSON())
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
 	}
+}
 
-	cleaned := []entities.Point{points[0]}
-	for i := 1; i < len(points)-1; i++ {
-		prev := cleaned[len(cleaned)-1]
-		curr := points[i]
-		next := points[i+1]
-
-		d1 := haversine(prev.Lat, prev.Lng, curr.Lat, curr.Lng)
-		d2 := haversine(curr.Lat, curr.Lng, next.Lat, next.Lng)
-		backtrack := haversine(prev.Lat, prev.Lng, next.Lat, next.Lng)
-
-		// If the segment doubles back, skip curr
-		if backtrack < d1 && backtrack < d2 && backtrack < minBacktrack {
-			continue
-		}
-		cleaned = append(cleaned, curr)
+// newServer applies the configured port and timeouts, so slow or idle clients
+// can't hold connections open indefinitely
+func newServer(cfg utils.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
 	}
-
-	cleaned = append(cleaned, points[len(points)-1])
-	return cleaned
 }
 
-// mergeDuplicateDescriptions merges consecutive identical street names
-func mergeDuplicateDescriptions(points []entities.Point) []entities.Point {
-	if len(points) == 0 {
-		return points
+// shuttingDown is set once serve starts draining, so /ready turns away new
+// traffic while in-flight requests finish
+var shuttingDown atomic.Bool
+
+// serve runs the server on ln until ctx is done (SIGINT or SIGTERM), then
+// stops accepting connections and waits up to drainTimeout for in-flight
+// requests to finish.
+func serve(ctx context.Context, server *http.Server, ln net.Listener, drainTimeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", ln.Addr().String())
+		errCh <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
 	}
 
-	merged := []entities.Point{points[0]}
-	for i := 1; i < len(points); i++ {
-		if points[i].Description != merged[len(merged)-1].Description {
-			merged = append(merged, points[i])
-		}
+	shuttingDown.Store(true)
+	slog.Info("shutdown started, draining in-flight requests", "timeout", drainTimeout.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := server.Shutdown(drainCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
 	}
-	return merged
-}
-
-// haversine returns distance in meters between two lat/lng points
-func haversine(lat1, lng1, lat2, lng2 float64) float64 {
-	const R = 6371000.0 // Earth radius in meters
-	lat1Rad := lat1 * math.Pi / 180.0
-	lat2Rad := lat2 * math.Pi / 180.0
-	dLat := (lat2 - lat1) * math.Pi / 180.0
-	dLng := (lng2 - lng1) * math.Pi / 180.0
-
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-			math.Sin(dLng/2)*math.Sin(dLng/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return R * c
+	slog.Info("shutdown complete")
+	return nil
 }
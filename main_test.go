@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bike-router/entities"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServe runs serve on a local port with a handler that blocks until
+// release is closed. It returns the URL, a func that stops the server as a
+// signal would, and serve's result.
+func startServe(t *testing.T, drainTimeout time.Duration, entered chan<- struct{}, release <-chan struct{}) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})}
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, server, ln, drainTimeout) }()
+	t.Cleanup(func() {
+		stop()
+		shuttingDown.Store(false)
+	})
+	return "http://" + ln.Addr().String(), stop, done
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	url, stop, done := startServe(t, 5*time.Second, entered, release)
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-entered
+
+	stop()
+	for deadline := time.Now().Add(5 * time.Second); !shuttingDown.Load(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("serve didn't start draining")
+		}
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("serve returned %v before the in-flight request finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("in-flight request got %d, want 200", got)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve() = %v, want nil after a clean drain", err)
+	}
+}
+
+func TestServeDrainTimeout(t *testing.T) {
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	url, stop, done := startServe(t, 50*time.Millisecond, entered, release)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+	stop()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "shutdown") {
+			t.Errorf("serve() = %v, want a shutdown error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve waited past its drain timeout")
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   string
+	}{
+		{"default", "", "", formatJSON},
+		{"any", "", "*/*", formatJSON},
+		{"protobuf", "", entities.ContentTypeProtobuf, formatProtobuf},
+		{"gpx", "", entities.ContentTypeGPX, formatGPX},
+		{"geojson", "", entities.ContentTypeGeoJSON, formatGeoJSON},
+		{"geojson among others", "", "application/geo+json, application/json;q=0.9", formatGeoJSON},
+		{"query wins", "format=gpx", entities.ContentTypeGeoJSON, formatGPX},
+		{"query geojson", "format=geojson", "", formatGeoJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/route?"+tt.query, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if got := responseFormat(r); got != tt.want {
+				t.Errorf("responseFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bike-router/entities"
+	"bike-router/router"
+	"encoding/json"
+	"net/http"
+)
+
+// mergeHandler stitches several routes, in order, into one continuous track.
+// The body uses the same {"routes": [...]} shape the /route endpoint returns.
+func mergeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, entities.CodeMethodNotAllowed, "only POST allowed")
+		return
+	}
+
+	var req entities.RouteOutput
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, entities.CodeInvalidJSON, "invalid json: "+err.Error())
+		return
+	}
+	if len(req.Routes) == 0 {
+		writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, "no routes to merge")
+		return
+	}
+
+	out := entities.RouteOutput{Routes: []entities.Route{router.MergeRoutes(req.Routes)}}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
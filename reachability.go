@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bike-router/entities"
+	"encoding/json"
+	"math"
+	"net/http"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// typicalSpeeds are average door-to-door speeds in m/s, including stops at
+// lights and junctions, not cruising speeds.
+var typicalSpeeds = map[maps.Mode]float64{
+	maps.TravelModeWalking:   1.3, // ~4.7 km/h
+	maps.TravelModeBicycling: 4.2, // ~15 km/h
+	maps.TravelModeTransit:   5.5, // ~20 km/h including waits
+	maps.TravelModeDriving:   8.3, // ~30 km/h in town
+}
+
+// detourFactor is the usual ratio of street-network distance to straight-line
+// distance; the reachable circle shrinks by it
+const detourFactor = 1.3
+
+const defaultReachabilityMode = maps.TravelModeBicycling
+
+// reachabilityHandler returns a coarse "how far can I get" circle without
+// calling Google: the radius is the typical speed for the mode times the time
+// budget, divided by the detour factor. It is not an isochrone; rivers, hills
+// and one-way streets are ignored.
+func reachabilityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, entities.CodeMethodNotAllowed, "only POST allowed")
+		return
+	}
+
+	var req entities.ReachabilityInput
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, entities.CodeInvalidJSON, "invalid json: "+err.Error())
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = string(defaultReachabilityMode)
+	}
+	if _, ok := typicalSpeeds[maps.Mode(req.Mode)]; !ok {
+		writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, "mode must be walking, bicycling, transit or driving")
+		return
+	}
+	if err := req.Origin.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, "invalid Origin: "+err.Error())
+		return
+	}
+	if req.BudgetMinutes <= 0 {
+		writeError(w, http.StatusBadRequest, entities.CodeInvalidRequest, "BudgetMinutes must be positive")
+		return
+	}
+
+	out := entities.ReachabilityOutput{
+		Center:       req.Origin,
+		RadiusMeters: reachableRadius(maps.Mode(req.Mode), req.BudgetMinutes),
+		Mode:         req.Mode,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// reachableRadius is the straight-line distance covered in the budget at the
+// mode's typical speed
+func reachableRadius(mode maps.Mode, budgetMinutes float64) float64 {
+	return math.Round(typicalSpeeds[mode] * budgetMinutes * 60 / detourFactor)
+}
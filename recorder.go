@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bike-router/entities"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// requestRecorder appends each route request to a JSONL file that cmd/replay
+// can play back for load testing. Inputs are recorded as sent, before
+// defaults, so a replay departs at its own "now" rather than the recorded one.
+// RouteInput holds no credentials, but the lines do hold riders' origins and
+// destinations.
+type requestRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// requestLog is nil unless RECORD_REQUESTS_FILE is set
+var requestLog *requestRecorder
+
+func newRequestRecorder(path string) (*requestRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &requestRecorder{file: f}, nil
+}
+
+// recordedRequest is one line of the file: the input, sent back as a POST
+// body, and the query string with the options (format, summary, echo, ...)
+type recordedRequest struct {
+	Query string              `json:"query,omitempty"`
+	Input entities.RouteInput `json:"input"`
+}
+
+func (r *requestRecorder) Record(req entities.RouteInput, query string) error {
+	line, err := json.Marshal(recordedRequest{Query: query, Input: req})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// One write per line under the lock so concurrent requests don't interleave
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.file.Write(line)
+	return err
+}
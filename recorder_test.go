@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bike-router/entities"
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRequestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	recorder, err := newRequestRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := []struct {
+		input entities.RouteInput
+		query string
+	}{
+		{entities.RouteInput{Origin: &entities.Coordinates{Lat: 37.7749, Lng: -122.4194}, Destination: "Ferry Building"}, "format=gpx&handoff=true"},
+		{entities.RouteInput{OriginAddress: "Mission Dolores", Destination: "Ferry Building", Mode: "walking"}, ""},
+	}
+	var wg sync.WaitGroup
+	for _, in := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := recorder.Record(in.input, in.query); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got := map[string]recordedRequest{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec recordedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		got[rec.Input.Destination+"|"+rec.Input.OriginAddress] = rec
+	}
+	if len(got) != len(inputs) {
+		t.Fatalf("got %d recorded lines, want %d", len(got), len(inputs))
+	}
+	for _, in := range inputs {
+		rec, ok := got[in.input.Destination+"|"+in.input.OriginAddress]
+		switch {
+		case !ok:
+			t.Errorf("%+v was not recorded", in.input)
+		case rec.Query != in.query:
+			t.Errorf("query = %q, want %q", rec.Query, in.query)
+		case rec.Input.Mode != in.input.Mode || !rec.Input.DepartureTime.IsZero():
+			t.Errorf("input = %+v, want it as sent, without defaults", rec.Input)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package router
+
+import (
+	"bike-router/entities"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// streetTypes expands the street-type abbreviations Google ends street names with
+var streetTypes = map[string]string{
+	"Ave":  "Avenue",
+	"Blvd": "Boulevard",
+	"Cir":  "Circle",
+	"Ct":   "Court",
+	"Dr":   "Drive",
+	"Expy": "Expressway",
+	"Fwy":  "Freeway",
+	"Hwy":  "Highway",
+	"Ln":   "Lane",
+	"Pkwy": "Parkway",
+	"Pl":   "Place",
+	"Rd":   "Road",
+	"Sq":   "Square",
+	"St":   "Street",
+	"Ter":  "Terrace",
+	"Trl":  "Trail",
+}
+
+// compassPoints expands the compass abbreviations that start or end street names
+var compassPoints = map[string]string{
+	"N":  "North",
+	"S":  "South",
+	"E":  "East",
+	"W":  "West",
+	"NE": "Northeast",
+	"NW": "Northwest",
+	"SE": "Southeast",
+	"SW": "Southwest",
+}
+
+// expandAbbreviations spells out the abbreviations of one street name, by
+// position: a direction as the first or last word, a street type as the last
+// word or just before a trailing direction ("Main St NW"). Words elsewhere
+// are parts of the name ("Dr Martin Luther King Jr Blvd", "E Street"), except
+// "St" before a capitalized word, which is "Saint" ("St Johns Ave").
+func expandAbbreviations(name string) string {
+	words := strings.Fields(name)
+	last := len(words) - 1
+	typeAt := last
+	if last > 0 && compassPoints[trimWord(words[last])] != "" {
+		typeAt = last - 1
+	}
+	for i, word := range words {
+		core := trimWord(word)
+		trail := strings.TrimPrefix(word[len(core):], ".")
+
+		switch {
+		case (i == 0 || i == last) && compassPoints[core] != "":
+			words[i] = compassPoints[core] + trail
+		case i == typeAt && streetTypes[core] != "":
+			words[i] = streetTypes[core] + trail
+		case core == "St" && i < last && isCapitalized(words[i+1]):
+			words[i] = "Saint" + trail
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// trimWord drops the punctuation a word can end with
+func trimWord(word string) string {
+	return strings.TrimRight(word, ".,;:")
+}
+
+func isCapitalized(word string) bool {
+	return word != "" && word[0] >= 'A' && word[0] <= 'Z'
+}
+
+// spokenDistance formats meters in clean, unabbreviated units for speech,
+// rounded the way a person would say them
+func spokenDistance(meters int) string {
+	rounded := meters
+	switch {
+	case meters < 10:
+	case meters < 100:
+		rounded = int(math.Round(float64(meters)/10) * 10)
+	case meters < 1000:
+		rounded = int(math.Round(float64(meters)/50) * 50)
+	}
+
+	if rounded >= 1000 {
+		km := strings.TrimSuffix(fmt.Sprintf("%.1f", math.Round(float64(meters)/100)/10), ".0")
+		if km == "1" {
+			return "1 kilometer"
+		}
+		return km + " kilometers"
+	}
+	if rounded == 1 {
+		return "1 meter"
+	}
+	return fmt.Sprintf("%d meters", rounded)
+}
+
+// htmlToSpeech strips tags from a Google instruction. Each <div> holds a
+// separate remark (e.g. "Destination will be on the right"), so it becomes
+// its own sentence; other tags just separate words. The text between tags
+// has its abbreviations expanded on its own, since Google puts each street
+// name in a <b> of its own.
+func htmlToSpeech(html string) string {
+	sentences := []string{}
+	for _, part := range strings.Split(html, "<div") {
+		if i := strings.Index(part, ">"); i >= 0 && len(sentences) > 0 {
+			part = part[i+1:]
+		}
+		var b, run strings.Builder
+		flush := func() {
+			b.WriteString(expandAbbreviations(run.String()))
+			b.WriteRune(' ')
+			run.Reset()
+		}
+		inTag := false
+		for _, r := range part {
+			switch {
+			case r == '<':
+				inTag = true
+				flush()
+			case r == '>':
+				inTag = false
+			case !inTag:
+				run.WriteRune(r)
+			}
+		}
+		flush()
+		if text := strings.Join(strings.Fields(b.String()), " "); text != "" {
+			sentences = append(sentences, text)
+		}
+	}
+	return strings.Join(sentences, ". ")
+}
+
+// addAccessibleText writes a screen-reader friendly sentence for every
+// instruction: full words instead of abbreviations, plus how far to go
+// before the next instruction. It needs the complete, unfiltered list.
+func addAccessibleText(instructions []entities.Instruction) {
+	for i := range instructions {
+		text := htmlToSpeech(instructions[i].Instruction)
+		if i+1 < len(instructions) && instructions[i].Maneuver != "arrive" {
+			if dist := instructions[i+1].DistanceMeters - instructions[i].DistanceMeters; dist > 0 {
+				text += " and continue for " + spokenDistance(dist)
+			}
+		}
+		instructions[i].AccessibleText = text
+	}
+}
@@ -0,0 +1,46 @@
+package router
+
+import "testing"
+
+func TestExpandAbbreviations(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Market St", "Market Street"},
+		{"Dr Martin Luther King Jr Blvd", "Dr Martin Luther King Jr Boulevard"},
+		{"St Johns Ave", "Saint Johns Avenue"},
+		{"N Main St", "North Main Street"},
+		{"Main St NW", "Main Street Northwest"},
+		{"E Street", "East Street"},
+		{"Avenue S", "Avenue South"},
+		{"N S Rd", "North S Road"},
+		{"Exit Rd.", "Exit Road"},
+		{"Valencia St,", "Valencia Street,"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandAbbreviations(tt.name); got != tt.want {
+				t.Errorf("expandAbbreviations(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLToSpeech(t *testing.T) {
+	tests := []struct {
+		html, want string
+	}{
+		{"Turn <b>left</b> onto <b>Dr Martin Luther King Jr Blvd</b>", "Turn left onto Dr Martin Luther King Jr Boulevard"},
+		{"Head <b>north</b> on <b>N Main St</b> toward <b>E Pine St</b>", "Head north on North Main Street toward East Pine Street"},
+		{"Turn <b>right</b> onto <b>Market St</b><div style=\"font-size:0.9em\">Destination will be on the right</div>",
+			"Turn right onto Market Street. Destination will be on the right"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := htmlToSpeech(tt.html); got != tt.want {
+				t.Errorf("htmlToSpeech(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package router
+
+import (
+	"bike-router/entities"
+	"bike-router/utils"
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// lookupCache memoizes Maps lookups. It holds at most maxEntries, evicting the
+// least recently used entry when full, and drops entries older than ttl.
+// A zero maxEntries or ttl disables that limit.
+type lookupCache[T any] struct {
+	name       string
+	maxEntries int
+	ttl        time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	order     *list.List // front is most recently used
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type cacheEntry[T any] struct {
+	key     string
+	value   T
+	expires time.Time
+}
+
+func newLookupCache[T any](name string, maxEntries int, ttl time.Duration) *lookupCache[T] {
+	c := &lookupCache[T]{
+		name:       name,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+	registerCache(c)
+	return c
+}
+
+func (c *lookupCache[T]) Get(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if ok && c.ttl > 0 && time.Now().After(el.Value.(*cacheEntry[T]).expires) {
+		c.remove(el)
+		c.evictions++
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		var zero T
+		return zero, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry[T]).value, true
+}
+
+func (c *lookupCache[T]) Set(key string, v T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry[T])
+		entry.value, entry.expires = v, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry[T]{key: key, value: v, expires: expires})
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+func (c *lookupCache[T]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry[T]).key)
+}
+
+func (c *lookupCache[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *lookupCache[T]) Stats() entities.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return entities.CacheStats{
+		Name:       c.name,
+		Size:       c.order.Len(),
+		MaxEntries: c.maxEntries,
+		TTLSeconds: int(c.ttl / time.Second),
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Evictions:  c.evictions,
+	}
+}
+
+// statsSource is any cache that reports metrics on /metrics.
+type statsSource interface {
+	Stats() entities.CacheStats
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   = map[string]statsSource{}
+)
+
+// registerCache makes a cache visible on /metrics. A cache created again under
+// the same name (e.g. after loading the config) replaces the old one.
+func registerCache(c statsSource) {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	caches[c.Stats().Name] = c
+}
+
+// CacheStats returns every registered cache's metrics, sorted by name.
+func CacheStats() []entities.CacheStats {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	out := make([]entities.CacheStats, 0, len(caches))
+	for _, c := range caches {
+		out = append(out, c.Stats())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+var (
+	elevationCache = newLookupCache[float64]("elevation", 0, 0)
+	geocodeCache   = newLookupCache[[]maps.GeocodingResult]("reverse_geocode", 0, 0)
+)
+
+// configureCaches replaces the default unbounded caches with ones sized by the config.
+func configureCaches(cfg utils.Config) {
+	elevationCache = newLookupCache[float64]("elevation", cfg.ElevationCacheMaxEntries, cfg.ElevationCacheTTL)
+	geocodeCache = newLookupCache[[]maps.GeocodingResult]("reverse_geocode", cfg.GeocodeCacheMaxEntries, cfg.GeocodeCacheTTL)
+}
+
+// coordKey rounds to 5 decimal places (~1 m) so nearby lookups share an entry.
+func coordKey(lat, lng float64) string {
+	return fmt.Sprintf("%.5f,%.5f", lat, lng)
+}
+
+const (
+	warmupTimeout  = 30 * time.Second
+	warmupInterval = 200 * time.Millisecond // pause between locations to stay under quota
+)
+
+// WarmCaches primes the elevation and reverse-geocode caches for the configured
+// hot locations. It runs once at startup and gives up after warmupTimeout.
+func WarmCaches(client MapsClient, locations []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+	defer cancel()
+
+	warmed, failed := warmCaches(ctx, client, locations)
+	slog.Info("cache warm-up done", "warmed", warmed, "failed", failed,
+		"elevation_entries", elevationCache.Len(), "geocode_entries", geocodeCache.Len())
+}
+
+// warmCaches looks up each location in turn. A location counts as warmed
+// when at least one of its lookups succeeded, and as failed otherwise or
+// when ctx ran out before it.
+func warmCaches(ctx context.Context, client MapsClient, locations []string) (warmed, failed int) {
+	for i, location := range locations {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(warmupInterval):
+			}
+		}
+		if ctx.Err() != nil {
+			failed += len(locations) - i
+			break
+		}
+
+		latLng, err := resolveWarmupLocation(ctx, client, location)
+		if err != nil {
+			slog.Warn("cache warm-up failed", "location", location, "error", err.Error())
+			failed++
+			continue
+		}
+		_, elevationErr := getElevation(ctx, client, latLng.Lat, latLng.Lng)
+		if elevationErr != nil {
+			slog.Warn("cache warm-up elevation failed", "location", location, "error", elevationErr.Error())
+		}
+		_, geocodeErr := reverseGeocode(ctx, client, latLng.Lat, latLng.Lng, "")
+		if geocodeErr != nil {
+			slog.Warn("cache warm-up reverse geocode failed", "location", location, "error", geocodeErr.Error())
+		}
+		if elevationErr != nil && geocodeErr != nil {
+			failed++
+			continue
+		}
+		warmed++
+	}
+	return warmed, failed
+}
+
+// resolveWarmupLocation accepts a "lat,lng" pair or geocodes a free-text address.
+func resolveWarmupLocation(ctx context.Context, client MapsClient, location string) (maps.LatLng, error) {
+	if latLng, err := maps.ParseLatLng(location); err == nil {
+		return latLng, nil
+	}
+
+	resp, err := client.Geocode(ctx, &maps.GeocodingRequest{Address: location})
+	if err != nil {
+		return maps.LatLng{}, err
+	}
+	if len(resp) == 0 {
+		return maps.LatLng{}, fmt.Errorf("no geocoding results")
+	}
+	return resp[0].Geometry.Location, nil
+}
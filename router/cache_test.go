@@ -0,0 +1,46 @@
+package router
+
+import (
+	"bike-router/router/routertest"
+	"errors"
+	"testing"
+
+	maps "googlemaps.github.io/maps"
+)
+
+func TestWarmCaches(t *testing.T) {
+	setupRouter(t)
+	noElevation := maps.LatLng{Lat: 37.2, Lng: -122.2}
+	nothing := maps.LatLng{Lat: 37.3, Lng: -122.3}
+	client := &routertest.MapsClient{
+		ElevationFunc: func(r *maps.ElevationRequest) ([]maps.ElevationResult, error) {
+			if ll := r.Locations[0]; ll == noElevation || ll == nothing {
+				return nil, errors.New("elevation unavailable")
+			}
+			return []maps.ElevationResult{{Elevation: 10}}, nil
+		},
+		ReverseGeocodeFunc: func(r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+			if *r.LatLng == nothing {
+				return nil, errors.New("geocoding unavailable")
+			}
+			return []maps.GeocodingResult{routertest.StreetResult("Market St")}, nil
+		},
+		GeocodeFunc: func(*maps.GeocodingRequest) ([]maps.GeocodingResult, error) { return nil, nil },
+	}
+
+	warmed, failed := warmCaches(t.Context(), client, []string{
+		"37.1,-122.1",  // both lookups succeed
+		"37.2,-122.2",  // only the reverse geocode succeeds
+		"37.3,-122.3",  // both fail
+		"Nowhere Land", // doesn't geocode
+	})
+	if warmed != 2 || failed != 2 {
+		t.Errorf("warmed %d, failed %d; want 2 and 2", warmed, failed)
+	}
+	if n := elevationCache.Len(); n != 1 {
+		t.Errorf("%d elevations cached, want 1", n)
+	}
+	if n := geocodeCache.Len(); n != 2 {
+		t.Errorf("%d reverse geocodes cached, want 2", n)
+	}
+}
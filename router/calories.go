@@ -0,0 +1,37 @@
+package router
+
+import (
+	"math"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// Calorie model. Riding or walking on the flat burns the mode's MET (energy
+// per kg of body weight per hour, 1 MET being rest) for the trip's duration;
+// climbing adds the work of lifting the rider, at the muscles' efficiency.
+const (
+	muscleEfficiency = 0.25
+	joulesPerKcal    = 4184.0
+	maxRiderWeightKg = 500.0
+)
+
+// metByMode is from the Compendium of Physical Activities: walking at a
+// moderate 5 km/h, and leisure cycling at 16-19 km/h, close to Google's
+// bicycling speeds. Driving and transit get no estimate.
+var metByMode = map[maps.Mode]float64{
+	maps.TravelModeWalking:   3.5,
+	maps.TravelModeBicycling: 6.8,
+}
+
+// estimateCalories returns the kcal a rider of weightKg burns over the
+// duration and climb, or 0 for modes without a MET value
+func estimateCalories(mode maps.Mode, weightKg float64, duration time.Duration, ascentMeters float64) float64 {
+	met, ok := metByMode[mode]
+	if !ok {
+		return 0
+	}
+	flat := met * weightKg * duration.Hours()
+	climb := weightKg * gravity * ascentMeters / muscleEfficiency / joulesPerKcal
+	return math.Round(flat + climb)
+}
@@ -0,0 +1,51 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+func TestEstimateCalories(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     maps.Mode
+		weightKg float64
+		duration time.Duration
+		ascent   float64
+		want     float64
+	}{
+		{"bicycling flat", maps.TravelModeBicycling, 70, time.Hour, 0, 476},         // 6.8 MET x 70 kg x 1 h
+		{"walking flat", maps.TravelModeWalking, 80, 30 * time.Minute, 0, 140},      // 3.5 x 80 x 0.5
+		{"bicycling climb", maps.TravelModeBicycling, 70, time.Hour, 100, 476 + 66}, // 70 x 9.81 x 100 / 0.25 / 4184
+		{"climb only", maps.TravelModeWalking, 100, 0, 500, 469},                    // 100 x 9.81 x 500 / 0.25 / 4184
+		{"driving", maps.TravelModeDriving, 70, time.Hour, 100, 0},
+		{"transit", maps.TravelModeTransit, 70, time.Hour, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateCalories(tt.mode, tt.weightKg, tt.duration, tt.ascent); got != tt.want {
+				t.Errorf("estimateCalories() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRouteCalories(t *testing.T) {
+	setupRouter(t)
+	// Google's leg total, longer than its steps add up to
+	rt := testRoute()
+	rt.Legs[0].Duration = time.Hour
+	req := validInput()
+	req.RiderWeightKg = 70
+	ApplyDefaults(&req)
+
+	out, err := BuildRoute(t.Context(), testClient(rt), req, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Routes[0].EstimatedCalories; got != 476 {
+		t.Errorf("EstimatedCalories = %v, want 476 for an hour on the flat", got)
+	}
+}
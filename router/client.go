@@ -0,0 +1,96 @@
+package router
+
+import (
+	"context"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// mapsAdapter is the production MapsClient: it wraps *maps.Client with what
+// every call needs, retries of transient failures, the per-API concurrency
+// limits and the rotation across API keys, so the pipeline only deals with
+// the lookups themselves
+type mapsAdapter struct {
+	keys *keyPool
+}
+
+// NewMapsClient adapts one *maps.Client per API key for the router; calls are
+// spread across them in turn
+func NewMapsClient(clients ...*maps.Client) MapsClient {
+	return mapsAdapter{keys: newKeyPool(clients)}
+}
+
+// KeyStatus reports how many of client's API keys are usable right now, i.e.
+// not cooling down after going over quota, out of how many it has. Clients
+// not made by NewMapsClient, such as test fakes, report 1 of 1.
+func KeyStatus(client MapsClient) (usable, total int) {
+	a, ok := client.(mapsAdapter)
+	if !ok {
+		return 1, 1
+	}
+	return a.keys.usable(), len(a.keys.clients)
+}
+
+// do runs call with retries. A quota error moves on to the next key at once,
+// without using up an attempt, as long as another key still has quota. While
+// every key is cooling down for longer than a retry would wait, it fails with
+// errKeysOverQuota without calling Google.
+func (a mapsAdapter) do(ctx context.Context, call func(*maps.Client) error) error {
+	return withRetry(ctx, mapsRetry, func() (err error) {
+		for range a.keys.clients {
+			i, ok := a.keys.pick()
+			if !ok {
+				return errKeysOverQuota
+			}
+			if err = call(a.keys.clients[i]); err == nil || !isQuotaError(err) {
+				return err
+			}
+			if !a.keys.bench(ctx, i, err) {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+func (a mapsAdapter) Directions(ctx context.Context, r *maps.DirectionsRequest) (routes []maps.Route, waypoints []maps.GeocodedWaypoint, err error) {
+	err = a.do(ctx, func(client *maps.Client) (err error) {
+		routes, waypoints, err = client.Directions(ctx, r)
+		return err
+	})
+	return routes, waypoints, err
+}
+
+func (a mapsAdapter) Elevation(ctx context.Context, r *maps.ElevationRequest) (resp []maps.ElevationResult, err error) {
+	if err := elevationLimiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer elevationLimiter.release()
+
+	err = a.do(ctx, func(client *maps.Client) (err error) {
+		resp, err = client.Elevation(ctx, r)
+		return err
+	})
+	return resp, err
+}
+
+func (a mapsAdapter) Geocode(ctx context.Context, r *maps.GeocodingRequest) (resp []maps.GeocodingResult, err error) {
+	err = a.do(ctx, func(client *maps.Client) (err error) {
+		resp, err = client.Geocode(ctx, r)
+		return err
+	})
+	return resp, err
+}
+
+func (a mapsAdapter) ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) (resp []maps.GeocodingResult, err error) {
+	if err := geocodeLimiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer geocodeLimiter.release()
+
+	err = a.do(ctx, func(client *maps.Client) (err error) {
+		resp, err = client.ReverseGeocode(ctx, r)
+		return err
+	})
+	return resp, err
+}
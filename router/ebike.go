@@ -0,0 +1,49 @@
+package router
+
+import (
+	"bike-router/entities"
+	"math"
+)
+
+// E-bike energy model. Each segment between consecutive points needs enough
+// mechanical energy to overcome rolling resistance and air drag at assist
+// speed, plus lift the rider up any climb (descents are coasted, no regen).
+// The motor supplies the assist level's share of that energy, drawn from the
+// battery through the drivetrain's efficiency.
+const (
+	ebikeMassKg        = 100.0 // rider plus bike
+	ebikeRollingCoeff  = 0.006
+	ebikeDragArea      = 0.5   // CdA in m^2, upright rider
+	ebikeAirDensity    = 1.225 // kg/m^3
+	ebikeAssistSpeed   = 6.9   // m/s, ~25 km/h where most motors cut out
+	ebikeMotorEff      = 0.75
+	joulesPerWattHour  = 3600.0
+	defaultAssistLevel = "tour"
+)
+
+// assistShare is the fraction of the pedalling energy the motor provides
+var assistShare = map[string]float64{
+	"eco":   0.3,
+	"tour":  0.5,
+	"sport": 0.65,
+	"turbo": 0.8,
+}
+
+// estimateBatteryWh returns the battery energy in Wh used along the points
+func estimateBatteryWh(points []entities.Point, assistLevel string) float64 {
+	share, ok := assistShare[assistLevel]
+	if !ok {
+		share = assistShare[defaultAssistLevel]
+	}
+
+	dragForce := 0.5 * ebikeAirDensity * ebikeDragArea * ebikeAssistSpeed * ebikeAssistSpeed
+	rollingForce := ebikeRollingCoeff * ebikeMassKg * gravity
+
+	joules := 0.0
+	for j := 1; j < len(points); j++ {
+		dist := haversine(points[j-1].Lat, points[j-1].Lng, points[j].Lat, points[j].Lng)
+		climb := math.Max(points[j].Elevation-points[j-1].Elevation, 0)
+		joules += (rollingForce+dragForce)*dist + ebikeMassKg*gravity*climb
+	}
+	return joules * share / ebikeMotorEff / joulesPerWattHour
+}
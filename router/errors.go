@@ -0,0 +1,79 @@
+package router
+
+import (
+	"bike-router/entities"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// InputError is a RouteInput that failed validation; its text tells the
+// client what to fix
+type InputError string
+
+func (e InputError) Error() string { return string(e) }
+
+// NoMatchingRouteError means Google found routes but none met the request's
+// limits (climb, grade, surface)
+type NoMatchingRouteError string
+
+func (e NoMatchingRouteError) Error() string { return string(e) }
+
+// ErrNoRoutes means Google found no route at all
+var ErrNoRoutes = errors.New("no routes")
+
+// DirectionsError is a failed Directions API call
+type DirectionsError struct {
+	Err error
+}
+
+func (e *DirectionsError) Error() string { return "directions error: " + e.Err.Error() }
+
+func (e *DirectionsError) Unwrap() error { return e.Err }
+
+// IsRateLimited reports whether err came from the Maps rate limiter running
+// out of time for a token
+func IsRateLimited(err error) bool {
+	return errors.Is(err, errRateLimited)
+}
+
+func isTooManyRequests(err error) bool {
+	var statusErr *upstreamStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests
+}
+
+// mapsStatus is the status Google reported inside a 200 response, which the
+// client library words as "maps: NOT_FOUND - <message>"; "" for other errors
+func mapsStatus(err error) string {
+	_, after, ok := strings.Cut(err.Error(), "maps: ")
+	if !ok {
+		return ""
+	}
+	status, _, _ := strings.Cut(after, " ")
+	return status
+}
+
+// UpstreamErrorCode classifies an error from a Maps API call
+func UpstreamErrorCode(err error) entities.ErrorCode {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return entities.CodeTimeout
+	}
+	if isTooManyRequests(err) {
+		return entities.CodeOverQuota
+	}
+	switch mapsStatus(err) {
+	case "OVER_QUERY_LIMIT":
+		return entities.CodeOverQuota
+	case "REQUEST_DENIED", "OVER_DAILY_LIMIT":
+		// An invalid or restricted key, or billing not enabled
+		return entities.CodeUpstreamDenied
+	case "NOT_FOUND":
+		// The origin, destination or a waypoint address couldn't be geocoded
+		return entities.CodeAddressNotFound
+	case "INVALID_REQUEST", "MAX_WAYPOINTS_EXCEEDED", "MAX_ROUTE_LENGTH_EXCEEDED":
+		return entities.CodeInvalidRequest
+	default:
+		return entities.CodeUpstream
+	}
+}
@@ -0,0 +1,36 @@
+package router
+
+import (
+	"bike-router/entities"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUpstreamErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want entities.ErrorCode
+	}{
+		{"deadline", fmt.Errorf("elevation: %w", context.DeadlineExceeded), entities.CodeTimeout},
+		{"http 429", &DirectionsError{Err: &upstreamStatusError{StatusCode: 429}}, entities.CodeOverQuota},
+		{"http 503", &DirectionsError{Err: &upstreamStatusError{StatusCode: 503}}, entities.CodeUpstream},
+		{"over query limit", &DirectionsError{Err: errors.New("maps: OVER_QUERY_LIMIT - You have exceeded your rate-limit")}, entities.CodeOverQuota},
+		{"over daily limit", &DirectionsError{Err: errors.New("maps: OVER_DAILY_LIMIT - ")}, entities.CodeUpstreamDenied},
+		{"request denied", &DirectionsError{Err: errors.New("maps: REQUEST_DENIED - The provided API key is invalid.")}, entities.CodeUpstreamDenied},
+		{"not found", &DirectionsError{Err: errors.New("maps: NOT_FOUND - ")}, entities.CodeAddressNotFound},
+		{"invalid request", &DirectionsError{Err: errors.New("maps: INVALID_REQUEST - ")}, entities.CodeInvalidRequest},
+		{"route too long", &DirectionsError{Err: errors.New("maps: MAX_ROUTE_LENGTH_EXCEEDED - ")}, entities.CodeInvalidRequest},
+		{"unknown status", &DirectionsError{Err: errors.New("maps: UNKNOWN_ERROR - ")}, entities.CodeUpstream},
+		{"not a maps error", errors.New("connection reset by peer"), entities.CodeUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UpstreamErrorCode(tt.err); got != tt.want {
+				t.Errorf("UpstreamErrorCode(%q) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1199 @@
+package router
+
+import (
+	"bike-router/entities"
+	"bike-router/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	stdhtml "html"
+	"log/slog"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// handoffProfiles maps Google travel modes to OSRM profiles and Valhalla costings
+var handoffProfiles = map[maps.Mode][2]string{
+	maps.TravelModeWalking:   {"foot", "pedestrian"},
+	maps.TravelModeBicycling: {"bike", "bicycle"},
+	maps.TravelModeDriving:   {"car", "auto"},
+	maps.TravelModeTransit:   {"foot", "multimodal"},
+}
+
+// routingHandoff lists the resolved origin, waypoints and destination in
+// travel order (only the ends of leg when leg > 0), so the trip can be
+// re-routed by another engine
+func routingHandoff(rt maps.Route, mode maps.Mode, leg int) *entities.RoutingHandoff {
+	h := &entities.RoutingHandoff{Mode: string(mode)}
+	if profile, ok := handoffProfiles[mode]; ok {
+		h.OSRMProfile, h.ValhallaCosting = profile[0], profile[1]
+	}
+	for legIndex, l := range rt.Legs {
+		if leg > 0 && legIndex+1 != leg {
+			continue
+		}
+		if len(h.Coordinates) == 0 {
+			h.Coordinates = append(h.Coordinates, [2]float64{l.StartLocation.Lng, l.StartLocation.Lat})
+		}
+		h.Coordinates = append(h.Coordinates, [2]float64{l.EndLocation.Lng, l.EndLocation.Lat})
+	}
+	return h
+}
+
+// decodeStepPolylines joins the full-resolution polylines of every step (of
+// one leg when leg > 0), dropping the shared point where consecutive steps meet
+func decodeStepPolylines(rt maps.Route, leg int) []entities.Coordinates {
+	coords := []entities.Coordinates{}
+	for legIndex, l := range rt.Legs {
+		if leg > 0 && legIndex+1 != leg {
+			continue
+		}
+		for _, step := range l.Steps {
+			path, err := step.Polyline.Decode()
+			if err != nil {
+				continue
+			}
+			for _, ll := range path {
+				if n := len(coords); n > 0 && coords[n-1].Lat == ll.Lat && coords[n-1].Lng == ll.Lng {
+					continue
+				}
+				coords = append(coords, entities.Coordinates{Lat: ll.Lat, Lng: ll.Lng})
+			}
+		}
+	}
+	return coords
+}
+
+// legOverviewPolyline is Google's overview polyline of the route, or with leg
+// set that leg's path encoded from its steps, as the overview spans every leg
+func legOverviewPolyline(rt maps.Route, leg int) string {
+	if leg == 0 {
+		return rt.OverviewPolyline.Points
+	}
+	coords := decodeStepPolylines(rt, leg)
+	path := make([]maps.LatLng, len(coords))
+	for i, c := range coords {
+		path[i] = maps.LatLng{Lat: c.Lat, Lng: c.Lng}
+	}
+	return maps.Encode(path)
+}
+
+// legRequest narrows the directions request to its 1-based leg: from the stop
+// before it to the stop after, with no waypoints. leg 0 is the whole trip.
+func legRequest(dr *maps.DirectionsRequest, leg int) *maps.DirectionsRequest {
+	stops := append(append([]string{dr.Origin}, dr.Waypoints...), dr.Destination)
+	if leg <= 0 || leg >= len(stops) {
+		return dr
+	}
+	narrowed := *dr
+	narrowed.Origin, narrowed.Destination = stops[leg-1], stops[leg]
+	narrowed.Waypoints = nil
+	return &narrowed
+}
+
+// googleMapsURL builds a "open in Google Maps" link for the directions request
+// using the documented https://www.google.com/maps/dir/?api=1 format
+func googleMapsURL(dr *maps.DirectionsRequest) string {
+	q := url.Values{}
+	q.Set("api", "1")
+	q.Set("origin", dr.Origin)
+	q.Set("destination", dr.Destination)
+	if dr.Mode != "" {
+		q.Set("travelmode", string(dr.Mode))
+	}
+	if len(dr.Waypoints) > 0 {
+		q.Set("waypoints", strings.Join(dr.Waypoints, "|"))
+	}
+	return "https://www.google.com/maps/dir/?" + q.Encode()
+}
+
+// getElevation fetches elevation in meters for a given lat/lng
+func getElevation(ctx context.Context, client MapsClient, lat, lng float64) (float64, error) {
+	key := coordKey(lat, lng)
+	if elev, ok := elevationCache.Get(key); ok {
+		return elev, nil
+	}
+
+	resp, err := client.Elevation(ctx, &maps.ElevationRequest{
+		Locations: []maps.LatLng{{Lat: lat, Lng: lng}},
+	})
+	if err != nil || len(resp) == 0 {
+		return 0, err
+	}
+	elevationCache.Set(key, resp[0].Elevation)
+	return resp[0].Elevation, nil
+}
+
+// maxElevationLocations is the Elevation API's limit on locations per request
+const maxElevationLocations = 512
+
+// fillElevations sets every point's elevation with as few Elevation API calls
+// as possible: cached points are skipped and the rest are requested in
+// batches. A batch that fails, or returns a different number of results than
+// locations sent, falls back to per-point lookups so an elevation is never
+// assigned to the wrong point.
+func fillElevations(ctx context.Context, client MapsClient, points []entities.Point) {
+	var missing []int
+	for j := range points {
+		if elev, ok := elevationCache.Get(coordKey(points[j].Lat, points[j].Lng)); ok {
+			points[j].Elevation = elev
+		} else {
+			missing = append(missing, j)
+		}
+	}
+
+	for start := 0; start < len(missing); start += maxElevationLocations {
+		batch := missing[start:min(start+maxElevationLocations, len(missing))]
+		locations := make([]maps.LatLng, len(batch))
+		for k, j := range batch {
+			locations[k] = maps.LatLng{Lat: points[j].Lat, Lng: points[j].Lng}
+		}
+
+		resp, err := client.Elevation(ctx, &maps.ElevationRequest{Locations: locations})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil || len(resp) != len(batch) {
+			slog.WarnContext(ctx, "batched elevation failed, looking up one by one", "points", len(batch), "results", len(resp), "error", fmt.Sprint(err))
+			for _, j := range batch {
+				if elev, err := getElevation(ctx, client, points[j].Lat, points[j].Lng); err == nil {
+					points[j].Elevation = elev
+				}
+			}
+			continue
+		}
+		for k, j := range batch {
+			points[j].Elevation = resp[k].Elevation
+			elevationCache.Set(coordKey(points[j].Lat, points[j].Lng), resp[k].Elevation)
+		}
+	}
+}
+
+// Elevations looks up the elevation of every location, in order, with one
+// Elevation API call per maxElevationLocations; cached locations are not
+// requested again. Unlike fillElevations, any failed call fails the lookup.
+func Elevations(ctx context.Context, client MapsClient, locations []entities.Coordinates) ([]float64, error) {
+	elevations := make([]float64, len(locations))
+	var missing []int
+	for j, c := range locations {
+		if elev, ok := elevationCache.Get(coordKey(c.Lat, c.Lng)); ok {
+			elevations[j] = elev
+		} else {
+			missing = append(missing, j)
+		}
+	}
+
+	for start := 0; start < len(missing); start += maxElevationLocations {
+		batch := missing[start:min(start+maxElevationLocations, len(missing))]
+		request := make([]maps.LatLng, len(batch))
+		for k, j := range batch {
+			request[k] = maps.LatLng{Lat: locations[j].Lat, Lng: locations[j].Lng}
+		}
+
+		resp, err := client.Elevation(ctx, &maps.ElevationRequest{Locations: request})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp) != len(batch) {
+			return nil, fmt.Errorf("elevation: %d results for %d locations", len(resp), len(batch))
+		}
+		for k, j := range batch {
+			elevations[j] = resp[k].Elevation
+			elevationCache.Set(coordKey(locations[j].Lat, locations[j].Lng), resp[k].Elevation)
+		}
+	}
+	return elevations, nil
+}
+
+// reverseGeocode returns the (cached) reverse-geocode results for a lat/lng,
+// with names in the given language ("" for Google's default)
+func reverseGeocode(ctx context.Context, client MapsClient, lat, lng float64, language string) ([]maps.GeocodingResult, error) {
+	key := coordKey(lat, lng)
+	if language != "" {
+		key += "|" + language
+	}
+	if resp, ok := geocodeCache.Get(key); ok {
+		return resp, nil
+	}
+
+	resp, err := client.ReverseGeocode(ctx, &maps.GeocodingRequest{
+		LatLng:   &maps.LatLng{Lat: lat, Lng: lng},
+		Language: language,
+	})
+	if err != nil {
+		return nil, err
+	}
+	geocodeCache.Set(key, resp)
+	return resp, nil
+}
+
+// streetNameFromGeocode tries to get a clean street name from reverse-geocode
+// results and ignores Plus Codes or generic placeholders.
+func streetNameFromGeocode(resp []maps.GeocodingResult) string {
+	if len(resp) == 0 {
+		return ""
+	}
+	if name := routeNameFromGeocode(resp); name != "" {
+		return name
+	}
+
+	formatted := resp[0].FormattedAddress
+	if strings.Contains(formatted, "+") || strings.Contains(formatted, "Unnamed") {
+		return ""
+	}
+	return formatted
+}
+
+// routeNameFromGeocode returns the first usable route component, looking past
+// the first result since it sometimes lacks one while a later result has it
+func routeNameFromGeocode(resp []maps.GeocodingResult) string {
+	for _, result := range resp {
+		for _, comp := range result.AddressComponents {
+			for _, t := range comp.Types {
+				if t == "route" {
+					name := comp.LongName
+					if !strings.Contains(name, "+") && !strings.HasPrefix(name, "Unnamed") {
+						return name
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// geocodeHasType reports whether any reverse-geocode result has the given type
+func geocodeHasType(resp []maps.GeocodingResult, want string) bool {
+	for _, result := range resp {
+		for _, t := range result.Types {
+			if t == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isIntersection guesses whether a location is a junction: Google tags it as
+// an intersection, or the results near it name more than one street. It is a
+// heuristic; a point mid-block near a corner can match too.
+func isIntersection(resp []maps.GeocodingResult) bool {
+	if geocodeHasType(resp, "intersection") {
+		return true
+	}
+	streets := map[string]bool{}
+	for _, result := range resp {
+		for _, comp := range result.AddressComponents {
+			for _, t := range comp.Types {
+				if t == "route" {
+					streets[comp.LongName] = true
+				}
+			}
+		}
+	}
+	return len(streets) > 1
+}
+
+// adminArea is the administrative hierarchy a point falls in
+type adminArea struct {
+	State, County, Locality string
+}
+
+// adminAreaFromGeocode reads the state, county and locality components
+func adminAreaFromGeocode(resp []maps.GeocodingResult) adminArea {
+	var area adminArea
+	for _, result := range resp {
+		for _, comp := range result.AddressComponents {
+			for _, t := range comp.Types {
+				switch {
+				case t == "administrative_area_level_1" && area.State == "":
+					area.State = comp.LongName
+				case t == "administrative_area_level_2" && area.County == "":
+					area.County = comp.LongName
+				case t == "locality" && area.Locality == "":
+					area.Locality = comp.LongName
+				}
+			}
+		}
+	}
+	return area
+}
+
+// markBoundaryCrossings flags each point whose area differs from the previous
+// point's, naming the new area at the highest level that changed. Points with
+// an unknown area neither start nor end a crossing.
+func markBoundaryCrossings(points []entities.Point, areas map[string]adminArea) {
+	var prev adminArea
+	havePrev := false
+	for j := range points {
+		area, ok := areas[coordKey(points[j].Lat, points[j].Lng)]
+		if !ok || area == (adminArea{}) {
+			continue
+		}
+		if havePrev {
+			switch {
+			case area.State != "" && prev.State != "" && area.State != prev.State:
+				points[j].BoundaryCrossing = &entities.BoundaryCrossing{Level: "state", Name: area.State}
+			case area.County != "" && prev.County != "" && area.County != prev.County:
+				points[j].BoundaryCrossing = &entities.BoundaryCrossing{Level: "county", Name: area.County}
+			case area.Locality != "" && prev.Locality != "" && area.Locality != prev.Locality:
+				points[j].BoundaryCrossing = &entities.BoundaryCrossing{Level: "locality", Name: area.Locality}
+			}
+		}
+		prev, havePrev = area, true
+	}
+}
+
+// placeIDFromGeocode returns the Google place ID of the best reverse-geocode match
+func placeIDFromGeocode(resp []maps.GeocodingResult) string {
+	if len(resp) == 0 {
+		return ""
+	}
+	return resp[0].PlaceID
+}
+
+// routePlaceIDFromGeocode returns the place ID of a street-level result,
+// skipping building-level ones such as street_address or premise
+func routePlaceIDFromGeocode(resp []maps.GeocodingResult) string {
+	for _, result := range resp {
+		for _, t := range result.Types {
+			if t == "route" {
+				return result.PlaceID
+			}
+		}
+	}
+	return ""
+}
+
+// addressFromGeocode maps the first reverse-geocode result's components into
+// a structured address. Returns nil when there is nothing to map.
+func addressFromGeocode(resp []maps.GeocodingResult) *entities.Address {
+	if len(resp) == 0 {
+		return nil
+	}
+
+	addr := &entities.Address{FormattedAddress: resp[0].FormattedAddress}
+	for _, comp := range resp[0].AddressComponents {
+		for _, t := range comp.Types {
+			switch t {
+			case "street_number":
+				addr.StreetNumber = comp.LongName
+			case "route":
+				addr.Route = comp.LongName
+			case "locality":
+				addr.Locality = comp.LongName
+			case "administrative_area_level_1":
+				addr.AdministrativeArea = comp.LongName
+			case "postal_code":
+				addr.PostalCode = comp.LongName
+			case "country":
+				addr.Country = comp.LongName
+				addr.CountryCode = comp.ShortName
+			}
+		}
+	}
+	return addr
+}
+
+func stripHTML(s string) string {
+	out := make([]rune, 0, len(s))
+	inTag := false
+	for _, r := range s {
+		if r == '<' {
+			inTag = true
+			continue
+		}
+		if r == '>' {
+			inTag = false
+			continue
+		}
+		if !inTag {
+			out = append(out, r)
+		}
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// streetKeywords introduce the street in an instruction, by base language
+// and most specific first: "onto" names the street turned into, "on" the one
+// followed, and "toward" only the next street ahead, as in "Head
+// <b>north</b> toward <b>Main St</b>". Instructions in a language without
+// an entry aren't parsed.
+var streetKeywords = map[string][]string{
+	"en": {" onto ", " on ", " toward "},
+}
+
+// baseLanguage returns the lowercased base of a Google language code such as
+// "en-GB"; Google answers in English when no language is requested
+func baseLanguage(language string) string {
+	if language == "" {
+		return "en"
+	}
+	base, _, _ := strings.Cut(language, "-")
+	return asciiLower(base)
+}
+
+// streetKeywordsFor returns the keywords for a Google language code
+func streetKeywordsFor(language string) []string {
+	return streetKeywords[baseLanguage(language)]
+}
+
+// extractStreetNameFromHTML parses street name from Google HTML instructions
+// in the given language, e.g., "Turn <b>left</b> onto <b>Market St</b>" ->
+// "Market St". Returns "" when no street could be matched so callers can
+// fall back.
+func extractStreetNameFromHTML(html, language string) string {
+	// Google appends notes such as "Destination will be on the right" in a
+	// <div>; their "on" would otherwise match
+	if idx := strings.Index(asciiLower(html), "<div"); idx >= 0 {
+		html = html[:idx]
+	}
+
+	// Look for text in <b> tags that comes after a keyword. Only ASCII is
+	// lowered so byte offsets in lower stay valid in html; strings.ToLower
+	// can change the length of some multibyte characters.
+	lower := asciiLower(html)
+
+	for _, keyword := range streetKeywordsFor(language) {
+		idx := strings.Index(lower, keyword)
+		if idx < 0 {
+			continue
+		}
+		after := html[idx+len(keyword):]
+		// Find first <b>...</b> after the keyword
+		if start := strings.Index(after, "<b>"); start >= 0 {
+			after = after[start+3:]
+			if end := strings.Index(after, "</b>"); end >= 0 {
+				// Names can carry markup such as <wbr/> and entities such as &amp;
+				if name := stdhtml.UnescapeString(stripHTML(after[:end])); name != "" {
+					return name
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// asciiLower lowercases A-Z only, leaving every other byte untouched
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+// filterRoutes keeps the routes accepted by keep, preserving order and IDs
+func filterRoutes(routes []entities.Route, keep func(entities.Route) bool) []entities.Route {
+	kept := []entities.Route{}
+	for _, rt := range routes {
+		if keep(rt) {
+			kept = append(kept, rt)
+		}
+	}
+	return kept
+}
+
+// avoidUnpaved is the RouteInput.Avoid value that filters out unpaved routes
+const avoidUnpaved = "unpaved"
+
+// unpavedKeywords hint at a surface road bikes should avoid. Google doesn't
+// report surface types, so this only catches steps whose text mentions one.
+var unpavedKeywords = []string{"unpaved", "gravel", "dirt"}
+
+// mentionsUnpaved reports whether any instruction mentions an unpaved surface
+func mentionsUnpaved(instructions []entities.Instruction) bool {
+	for _, inst := range instructions {
+		text := strings.ToLower(stripHTML(inst.Instruction))
+		for _, kw := range unpavedKeywords {
+			if strings.Contains(text, kw) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const preferBikeLanes = "bikelanes"
+
+// bikeLaneKeywords hint that a step follows cycling infrastructure. Like the
+// unpaved check, this only sees what the instruction text mentions.
+var bikeLaneKeywords = []string{"bike lane", "bike path", "bikeway", "cycleway", "cycle track", "cycle path", "greenway", "trail"}
+
+// bikeLaneScore counts the instructions that mention bike infrastructure
+func bikeLaneScore(instructions []entities.Instruction) int {
+	score := 0
+	for _, inst := range instructions {
+		text := strings.ToLower(stripHTML(inst.Instruction))
+		for _, kw := range bikeLaneKeywords {
+			if strings.Contains(text, kw) {
+				score++
+				break
+			}
+		}
+	}
+	return score
+}
+
+// mostBikeLanes picks the route with the highest bikeLaneScore; ties go to
+// the earlier route, which Google ranks as better
+func mostBikeLanes(routes []entities.Route) entities.Route {
+	best := routes[0]
+	bestScore := bikeLaneScore(best.Instructions)
+	for _, rt := range routes[1:] {
+		if score := bikeLaneScore(rt.Instructions); score > bestScore {
+			best, bestScore = rt, score
+		}
+	}
+	return best
+}
+
+// stepInstructions are the instructions of Google's steps as they come, for
+// filtering and scoring a route that isn't built
+func stepInstructions(rt maps.Route) []entities.Instruction {
+	var instructions []entities.Instruction
+	for _, leg := range rt.Legs {
+		for _, step := range leg.Steps {
+			instructions = append(instructions, entities.Instruction{Instruction: step.HTMLInstructions})
+		}
+	}
+	return instructions
+}
+
+// estimateStopCount approximates how often a rider has to stop or slow down:
+// one per turn plus one per step start that reverse-geocodes to an intersection.
+// It is a heuristic for comparing routes, not a count of actual signals.
+func estimateStopCount(instructions []entities.Instruction, intersections int) int {
+	stops := intersections
+	for _, inst := range instructions {
+		if isTurn(inst.Maneuver) {
+			stops++
+		}
+	}
+	return stops
+}
+
+// isTurn reports whether an instruction's maneuver, as inferManeuver names
+// it from the wording before the street name, leaves the road being
+// followed. "Head", "continue" and "continue straight" steps don't, nor does
+// the arrival.
+func isTurn(maneuver string) bool {
+	switch maneuver {
+	case "", "straight", "arrive":
+		return false
+	}
+	return true
+}
+
+// filterInstructions trims the instruction list to the requested verbosity.
+// Minimal keeps only turns and the arrival; normal and verbose keep every
+// step, including "head" and "continue" steps (verbose has more of them, see
+// legSteps).
+func filterInstructions(instructions []entities.Instruction, verbosity string) []entities.Instruction {
+	if verbosity != entities.VerbosityMinimal {
+		return instructions
+	}
+
+	filtered := []entities.Instruction{}
+	for _, inst := range instructions {
+		if isTurn(inst.Maneuver) || inst.Maneuver == "arrive" {
+			filtered = append(filtered, inst)
+		}
+	}
+	return filtered
+}
+
+// legSteps are the steps a leg's instructions are built from. Verbose
+// replaces each step that has sub-steps (the walking and driving parts of a
+// transit trip) with them, which cover the same distance in more detail.
+func legSteps(leg *maps.Leg, verbosity string) []*maps.Step {
+	if verbosity != entities.VerbosityVerbose {
+		return leg.Steps
+	}
+	var steps []*maps.Step
+	for _, step := range leg.Steps {
+		if len(step.Steps) > 0 {
+			steps = append(steps, step.Steps...)
+		} else {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// simplifyRoute removes points that are too close together (< minDist meters).
+// A close point is still kept when the route turns there by more than
+// preserveTurnDeg degrees (0 disables), so sharp necessary turns survive.
+func simplifyRoute(points []entities.Point, minDist, preserveTurnDeg float64) []entities.Point {
+	if len(points) <= 2 {
+		return points
+	}
+
+	simplified := []entities.Point{points[0]} // keep first
+	for i := 1; i < len(points)-1; i++ {
+		last := simplified[len(simplified)-1]
+		curr := points[i]
+		dist := haversine(last.Lat, last.Lng, curr.Lat, curr.Lng)
+		if dist >= minDist || (preserveTurnDeg > 0 && turnAt(last, curr, points[i+1]) > preserveTurnDeg) {
+			simplified = append(simplified, curr)
+		}
+	}
+	simplified = append(simplified, points[len(points)-1])
+	return simplified
+}
+
+// Simplification algorithms accepted in RouteInput.Simplify
+const (
+	simplifyDistance       = "distance"
+	simplifyDouglasPeucker = "douglas-peucker"
+)
+
+// Simplification thresholds used when the request doesn't set them, and the
+// most a request may ask for before the route loses its shape entirely
+const (
+	defaultSimplifyMeters        = 50.0
+	defaultZigZagMeters          = 30.0
+	defaultSimplifyEpsilonMeters = 10.0
+	maxThresholdMeters           = 500.0
+)
+
+// douglasPeucker keeps the points needed for the line to stay within
+// epsilonMeters of the original (Ramer-Douglas-Peucker). Unlike the distance
+// threshold it drops collinear points however far apart, and keeps curves.
+func douglasPeucker(points []entities.Point, epsilonMeters float64) []entities.Point {
+	if len(points) <= 2 {
+		return points
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	markDouglasPeucker(points, 0, len(points)-1, epsilonMeters, keep)
+
+	simplified := []entities.Point{}
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// markDouglasPeucker keeps the point between first and last that is farthest
+// from their segment if it is out of tolerance, then recurses on both halves
+func markDouglasPeucker(points []entities.Point, first, last int, epsilonMeters float64, keep []bool) {
+	farthest, maxDist := -1, epsilonMeters
+	for i := first + 1; i < last; i++ {
+		if d := segmentDistance(points[i], points[first], points[last]); d > maxDist {
+			farthest, maxDist = i, d
+		}
+	}
+	if farthest < 0 {
+		return
+	}
+	keep[farthest] = true
+	markDouglasPeucker(points, first, farthest, epsilonMeters, keep)
+	markDouglasPeucker(points, farthest, last, epsilonMeters, keep)
+}
+
+// segmentDistance is the distance in meters from p to the segment a-b, on a
+// local flat projection around a (fine at route-step scale)
+func segmentDistance(p, a, b entities.Point) float64 {
+	const metersPerDegree = 6371000.0 * math.Pi / 180
+	cosLat := math.Cos(a.Lat * math.Pi / 180)
+	bx, by := (b.Lng-a.Lng)*cosLat*metersPerDegree, (b.Lat-a.Lat)*metersPerDegree
+	px, py := (p.Lng-a.Lng)*cosLat*metersPerDegree, (p.Lat-a.Lat)*metersPerDegree
+
+	t := 0.0
+	if lenSq := bx*bx + by*by; lenSq > 0 {
+		t = math.Max(0, math.Min(1, (px*bx+py*by)/lenSq))
+	}
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+// turnAt returns the absolute heading change in degrees at curr
+func turnAt(prev, curr, next entities.Point) float64 {
+	incoming := bearing(prev.Lat, prev.Lng, curr.Lat, curr.Lng)
+	outgoing := bearing(curr.Lat, curr.Lng, next.Lat, next.Lng)
+	return math.Abs(turnAngleDegrees(incoming, outgoing))
+}
+
+// removeZigZags removes small “back-and-forth” hops (<minBacktrack meters;
+// 0 or less disables it). A point where the route turns by more than
+// preserveTurnDeg degrees (0 disables) is kept, as simplifyRoute keeps it.
+func removeZigZags(points []entities.Point, minBacktrack, preserveTurnDeg float64) []entities.Point {
+	if len(points) < 3 || minBacktrack <= 0 {
+		return points
+	}
+
+	cleaned := []entities.Point{points[0]}
+	for i := 1; i < len(points)-1; i++ {
+		prev := cleaned[len(cleaned)-1]
+		curr := points[i]
+		next := points[i+1]
+
+		d1 := haversine(prev.Lat, prev.Lng, curr.Lat, curr.Lng)
+		d2 := haversine(curr.Lat, curr.Lng, next.Lat, next.Lng)
+		backtrack := haversine(prev.Lat, prev.Lng, next.Lat, next.Lng)
+
+		// If the segment doubles back, skip curr
+		preserved := preserveTurnDeg > 0 && turnAt(prev, curr, next) > preserveTurnDeg
+		if backtrack < d1 && backtrack < d2 && backtrack < minBacktrack && !preserved {
+			continue
+		}
+		cleaned = append(cleaned, curr)
+	}
+
+	cleaned = append(cleaned, points[len(points)-1])
+	return cleaned
+}
+
+// mergeDuplicateDescriptions merges consecutive identical street names
+func mergeDuplicateDescriptions(points []entities.Point) []entities.Point {
+	if len(points) == 0 {
+		return points
+	}
+
+	merged := []entities.Point{points[0]}
+	for i := 1; i < len(points); i++ {
+		if points[i].Description != merged[len(merged)-1].Description {
+			merged = append(merged, points[i])
+		}
+	}
+	return merged
+}
+
+// assignPointIndices points each instruction at the closest of the route's
+// final points, so clients can place maneuver markers on the drawn line
+func assignPointIndices(route *entities.Route) {
+	for i := range route.Instructions {
+		loc := route.Instructions[i].StartLocation
+		best, bestDist := 0, math.Inf(1)
+		for j, p := range route.Points {
+			if d := haversine(loc.Lat, loc.Lng, p.Lat, p.Lng); d < bestDist {
+				best, bestDist = j, d
+			}
+		}
+		route.Instructions[i].PointIndex = best
+	}
+}
+
+// snapToGrid rounds a coordinate to the given number of decimal places
+func snapToGrid(lat, lng float64, decimals int) (float64, float64) {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(lat*scale) / scale, math.Round(lng*scale) / scale
+}
+
+// snapRadiusMeters is about one grid cell at the given number of decimals:
+// anything closer than that to an exact end would give it away
+func snapRadiusMeters(decimals int) float64 {
+	return 111320 * math.Pow(10, -float64(decimals))
+}
+
+// applyPrivacySnap coarsens the route's origin and/or destination so the
+// exact spot (often the rider's home) isn't returned. Every position within
+// a grid cell of a snapped end is rounded to the grid, in the points,
+// instructions, polylines and handoff alike, and the Google Maps link is
+// rebuilt from the rounded ends instead of the request's. dr and leg are the
+// route's request and selected leg; a leg between two waypoints has no end to
+// snap.
+func applyPrivacySnap(route *entities.Route, rt maps.Route, dr *maps.DirectionsRequest, leg int, cfg utils.Config) {
+	snapOrigin := cfg.SnapOrigin && leg <= 1
+	snapDestination := cfg.SnapDestination && (leg == 0 || leg == len(rt.Legs))
+	if len(route.Points) == 0 || len(rt.Legs) == 0 || (!snapOrigin && !snapDestination) {
+		return
+	}
+	first, last := route.Points[0], route.Points[len(route.Points)-1]
+	var ends []maps.LatLng
+	if snapOrigin {
+		ends = append(ends, rt.Legs[0].StartLocation, maps.LatLng{Lat: first.Lat, Lng: first.Lng})
+	}
+	if snapDestination {
+		ends = append(ends, rt.Legs[len(rt.Legs)-1].EndLocation, maps.LatLng{Lat: last.Lat, Lng: last.Lng})
+	}
+	radius := snapRadiusMeters(cfg.SnapDecimals)
+	snap := func(lat, lng *float64) bool {
+		for _, end := range ends {
+			if haversine(*lat, *lng, end.Lat, end.Lng) <= radius {
+				*lat, *lng = snapToGrid(*lat, *lng, cfg.SnapDecimals)
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := range route.Points {
+		// A building-level place ID would locate the end just as well
+		if p := &route.Points[i]; snap(&p.Lat, &p.Lng) {
+			p.PlaceID = ""
+		}
+	}
+	for i := range route.Instructions {
+		loc := &route.Instructions[i].StartLocation
+		snap(&loc.Lat, &loc.Lng)
+	}
+	for i := range route.DecodedPolyline {
+		snap(&route.DecodedPolyline[i].Lat, &route.DecodedPolyline[i].Lng)
+	}
+	for i := range route.DistanceMarkers {
+		snap(&route.DistanceMarkers[i].Lat, &route.DistanceMarkers[i].Lng)
+	}
+	if route.Handoff != nil {
+		for i := range route.Handoff.Coordinates {
+			c := &route.Handoff.Coordinates[i]
+			snap(&c[1], &c[0])
+		}
+	}
+	if route.OverviewPolyline != "" {
+		path, err := maps.DecodePolyline(route.OverviewPolyline)
+		if err != nil {
+			route.OverviewPolyline = ""
+		} else {
+			for i := range path {
+				snap(&path[i].Lat, &path[i].Lng)
+			}
+			route.OverviewPolyline = maps.Encode(path)
+		}
+	}
+
+	// The request's ends may be the exact coordinates or a street address
+	link := *dr
+	if snapOrigin {
+		lat, lng := snapToGrid(rt.Legs[0].StartLocation.Lat, rt.Legs[0].StartLocation.Lng, cfg.SnapDecimals)
+		link.Origin = fmt.Sprintf("%g,%g", lat, lng)
+	}
+	if snapDestination {
+		end := rt.Legs[len(rt.Legs)-1].EndLocation
+		lat, lng := snapToGrid(end.Lat, end.Lng, cfg.SnapDecimals)
+		link.Destination = fmt.Sprintf("%g,%g", lat, lng)
+		// The house number pins the destination down as well as its coordinates
+		if route.DestinationAddress != nil {
+			addr := *route.DestinationAddress
+			addr.StreetNumber = ""
+			addr.FormattedAddress = ""
+			route.DestinationAddress = &addr
+		}
+	}
+	route.GoogleMapsURL = googleMapsURL(&link)
+}
+
+// bearing returns the initial compass bearing in degrees [0, 360) from one point to another
+func bearing(lat1, lng1, lat2, lng2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180.0
+	lat2Rad := lat2 * math.Pi / 180.0
+	dLng := (lng2 - lng1) * math.Pi / 180.0
+
+	y := math.Sin(dLng) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(dLng)
+	return math.Mod(math.Atan2(y, x)*180.0/math.Pi+360.0, 360.0)
+}
+
+// turnAngleDegrees returns the signed change of heading in (-180, 180]:
+// positive turns right (clockwise), negative turns left
+func turnAngleDegrees(incoming, outgoing float64) float64 {
+	angle := math.Mod(outgoing-incoming, 360.0)
+	if angle > 180 {
+		angle -= 360
+	} else if angle <= -180 {
+		angle += 360
+	}
+	return angle
+}
+
+// stepBearings returns the heading a step starts and ends on, using its
+// polyline when available and its start/end locations otherwise
+func stepBearings(step *maps.Step) (start, end float64) {
+	path, err := step.Polyline.Decode()
+	if err != nil || len(path) < 2 {
+		path = []maps.LatLng{step.StartLocation, step.EndLocation}
+	}
+	n := len(path)
+	start = bearing(path[0].Lat, path[0].Lng, path[1].Lat, path[1].Lng)
+	end = bearing(path[n-2].Lat, path[n-2].Lng, path[n-1].Lat, path[n-1].Lng)
+	return start, end
+}
+
+// MinMaxSegmentMeters keeps ?maxSegment from multiplying a long route into
+// hundreds of thousands of points
+const MinMaxSegmentMeters = 10.0
+
+// densifyRoute is the inverse of simplification: it inserts evenly spaced
+// points, with linearly interpolated elevation, so no two consecutive points
+// are more than maxMeters apart
+func densifyRoute(points []entities.Point, maxMeters float64) []entities.Point {
+	if len(points) < 2 || maxMeters <= 0 {
+		return points
+	}
+
+	out := []entities.Point{points[0]}
+	for j := 1; j < len(points); j++ {
+		a, b := points[j-1], points[j]
+		pieces := int(math.Ceil(haversine(a.Lat, a.Lng, b.Lat, b.Lng) / maxMeters))
+		for k := 1; k < pieces; k++ {
+			f := float64(k) / float64(pieces)
+			out = append(out, entities.Point{
+				Lat:       a.Lat + (b.Lat-a.Lat)*f,
+				Lng:       a.Lng + (b.Lng-a.Lng)*f,
+				Elevation: a.Elevation + (b.Elevation-a.Elevation)*f,
+			})
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// downhillThresholdMeters is the drop a segment needs before it counts as
+// downhill, so elevation noise on flat ground doesn't flicker the flag
+var downhillThresholdMeters = 1.0
+
+// markDownhill flags points where the segment leaving them descends by more
+// than downhillThresholdMeters. The last point has no segment leaving it and
+// is never flagged.
+func markDownhill(points []entities.Point) {
+	for j := range points {
+		points[j].IsDownHill = j+1 < len(points) &&
+			points[j].Elevation-points[j+1].Elevation > downhillThresholdMeters
+	}
+}
+
+// elevationTotals sums every climb and every descent along the points. A
+// change only counts once the elevation has moved more than
+// downhillThresholdMeters from where the last counted change ended, so noise
+// on flat ground doesn't add up while a steady climb in small steps still does.
+func elevationTotals(points []entities.Point) (ascent, descent float64) {
+	if len(points) == 0 {
+		return 0, 0
+	}
+	ref := points[0].Elevation
+	for _, p := range points[1:] {
+		switch delta := p.Elevation - ref; {
+		case delta > downhillThresholdMeters:
+			ascent += delta
+			ref = p.Elevation
+		case delta < -downhillThresholdMeters:
+			descent -= delta
+			ref = p.Elevation
+		}
+	}
+	return ascent, descent
+}
+
+// segmentGrade returns the grade in percent from a to b, positive uphill.
+// Segments too short to measure reliably count as flat.
+func segmentGrade(a, b entities.Point) float64 {
+	dist := haversine(a.Lat, a.Lng, b.Lat, b.Lng)
+	if dist < 1.0 {
+		return 0
+	}
+	return (b.Elevation - a.Elevation) / dist * 100
+}
+
+// maxPlausibleGrade caps per-point grades: a few meters of elevation error
+// over a short segment would otherwise report cliffs
+const maxPlausibleGrade = 40.0
+
+// assignGrades sets each point's grade towards the next point, clamped to
+// ±maxPlausibleGrade and rounded to 0.1%. The last point repeats the grade of
+// the segment arriving at it.
+func assignGrades(points []entities.Point) {
+	for j := range points {
+		switch {
+		case j+1 < len(points):
+			grade := math.Max(-maxPlausibleGrade, math.Min(maxPlausibleGrade, segmentGrade(points[j], points[j+1])))
+			points[j].GradePercent = math.Round(grade*10) / 10
+		case j > 0:
+			points[j].GradePercent = points[j-1].GradePercent
+		}
+	}
+}
+
+// minGradeRunMeters is the shortest stretch a climb grade is measured over,
+// so closely spaced points don't turn elevation noise into a wall
+const minGradeRunMeters = 20.0
+
+// maxClimbGrade returns the steepest uphill grade along the points, each
+// measured from a point to the first one at least minGradeRunMeters on (or
+// over the whole route when it is shorter) and capped at maxPlausibleGrade
+func maxClimbGrade(points []entities.Point) float64 {
+	steepest := 0.0
+	k, run := 0, 0.0 // points[k] is run meters along the route from points[j]
+	for j := 0; j+1 < len(points); j++ {
+		for k+1 < len(points) && run < minGradeRunMeters {
+			run += haversine(points[k].Lat, points[k].Lng, points[k+1].Lat, points[k+1].Lng)
+			k++
+		}
+		if run < minGradeRunMeters && j > 0 {
+			break // the rest is shorter than a run, already measured from earlier points
+		}
+		if run >= 1.0 {
+			steepest = math.Max(steepest, (points[k].Elevation-points[j].Elevation)/run*100)
+		}
+		run -= haversine(points[j].Lat, points[j].Lng, points[j+1].Lat, points[j+1].Lng)
+	}
+	return math.Min(steepest, maxPlausibleGrade)
+}
+
+const metersPerKilometer = 1000.0
+
+// gravity is the standard acceleration of gravity in m/s^2, for the work of
+// lifting a rider up a climb
+const gravity = 9.81
+
+// distanceMarkers interpolates a marker along the points at every whole
+// multiple of unitMeters, numbered 1, 2, 3...
+func distanceMarkers(points []entities.Point, unitMeters float64) []entities.DistanceMarker {
+	markers := []entities.DistanceMarker{}
+	travelled := 0.0
+	next := unitMeters
+	for j := 1; j < len(points); j++ {
+		a, b := points[j-1], points[j]
+		seg := haversine(a.Lat, a.Lng, b.Lat, b.Lng)
+		for seg > 0 && travelled+seg >= next {
+			t := (next - travelled) / seg
+			markers = append(markers, entities.DistanceMarker{
+				Coordinates: entities.Coordinates{Lat: a.Lat + t*(b.Lat-a.Lat), Lng: a.Lng + t*(b.Lng-a.Lng)},
+				Value:       len(markers) + 1,
+			})
+			next += unitMeters
+		}
+		travelled += seg
+	}
+	return markers
+}
+
+// routeBounds is Google's viewport for the route when it reports one and
+// useGoogle allows it, otherwise the box around points. Google's covers the
+// whole trip at full resolution, so it can't be used for a single leg or
+// with privacy snapping, whose exact ends it would give away.
+func routeBounds(rt maps.Route, points []entities.Point, useGoogle bool) entities.Bounds {
+	ne, sw := rt.Bounds.NorthEast, rt.Bounds.SouthWest
+	if useGoogle && (ne != maps.LatLng{} || sw != maps.LatLng{}) {
+		return entities.Bounds{
+			NorthEast: entities.Coordinates{Lat: ne.Lat, Lng: ne.Lng},
+			SouthWest: entities.Coordinates{Lat: sw.Lat, Lng: sw.Lng},
+		}
+	}
+	if len(points) == 0 {
+		return entities.Bounds{}
+	}
+	b := entities.Bounds{
+		NorthEast: entities.Coordinates{Lat: points[0].Lat, Lng: points[0].Lng},
+		SouthWest: entities.Coordinates{Lat: points[0].Lat, Lng: points[0].Lng},
+	}
+	for _, p := range points[1:] {
+		b.NorthEast.Lat = max(b.NorthEast.Lat, p.Lat)
+		b.NorthEast.Lng = max(b.NorthEast.Lng, p.Lng)
+		b.SouthWest.Lat = min(b.SouthWest.Lat, p.Lat)
+		b.SouthWest.Lng = min(b.SouthWest.Lng, p.Lng)
+	}
+	return b
+}
+
+// departureTime is when the trip starts, or with req.Leg set when that leg
+// does: the requested departure plus the legs ridden before it, or for an
+// arrival time the scheduled departure of a transit leg, else the arrival
+// minus the duration of the legs from it on. It is shown in the trip's own
+// time zone when Google reports one (transit legs), otherwise in the zone it
+// was given in.
+func departureTime(req entities.RouteInput, rt maps.Route) time.Time {
+	first := 0
+	if req.Leg > 0 && req.Leg <= len(rt.Legs) {
+		first = req.Leg - 1
+	}
+	var before, after time.Duration
+	for i, leg := range rt.Legs {
+		if i < first {
+			before += leg.Duration
+		} else {
+			after += leg.Duration
+		}
+	}
+
+	depart := req.DepartureTime.Add(before)
+	if req.DepartureTime.IsZero() {
+		depart = req.ArrivalTime.Add(-after)
+		if len(rt.Legs) > 0 && !rt.Legs[first].DepartureTime.IsZero() {
+			depart = rt.Legs[first].DepartureTime
+		}
+	}
+	if len(rt.Legs) > 0 && !rt.Legs[first].DepartureTime.IsZero() {
+		return depart.In(rt.Legs[first].DepartureTime.Location())
+	}
+	return depart
+}
+
+// assignEstimatedTimes sets each instruction's clock time from the departure
+// and its cumulative duration
+func assignEstimatedTimes(instructions []entities.Instruction, depart time.Time) {
+	for i := range instructions {
+		at := depart.Add(time.Duration(instructions[i].DurationSeconds) * time.Second)
+		instructions[i].EstimatedTime = at.Format(time.RFC3339)
+	}
+}
+
+// routeHash fingerprints what a client renders: each point's position,
+// elevation and description, and each instruction's text, street, distance,
+// duration and location, in order. Clock times and other derived text are
+// left out, so the same route recomputed later hashes the same.
+func routeHash(route entities.Route) string {
+	h := sha256.New()
+	for _, p := range route.Points {
+		fmt.Fprintf(h, "p|%.6f|%.6f|%.1f|%s\n", p.Lat, p.Lng, p.Elevation, p.Description)
+	}
+	for _, inst := range route.Instructions {
+		fmt.Fprintf(h, "i|%s|%s|%d|%d|%.6f|%.6f\n", inst.Instruction, inst.StreetName,
+			inst.DistanceMeters, inst.DurationSeconds, inst.StartLocation.Lat, inst.StartLocation.Lng)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// co2SavedGrams is what a car emitting gramsPerKm would have emitted over the
+// distance
+func co2SavedGrams(distanceMeters int, gramsPerKm float64) int {
+	return int(math.Round(float64(distanceMeters) / metersPerKilometer * gramsPerKm))
+}
+
+// reconcileLegDistances rescales one leg's cumulative instruction distances so
+// the leg ends exactly at Google's leg total. Summing whole-meter step
+// distances drifts from that total; the difference is spread in proportion to
+// how far along the leg each instruction is.
+func reconcileLegDistances(legInstructions []entities.Instruction, legStart, stepSum, legMeters int) {
+	if stepSum <= 0 || stepSum == legMeters {
+		return
+	}
+	scale := float64(legMeters) / float64(stepSum)
+	for i := range legInstructions {
+		offset := legInstructions[i].DistanceMeters - legStart
+		legInstructions[i].DistanceMeters = legStart + int(math.Round(float64(offset)*scale))
+	}
+}
+
+// coincidentMeters is how close two positions must be to count as the same spot
+const coincidentMeters = 1.0
+
+// isCoincident reports whether two positions are within coincidentMeters
+func isCoincident(lat1, lng1, lat2, lng2 float64) bool {
+	return haversine(lat1, lng1, lat2, lng2) < coincidentMeters
+}
+
+// haversine returns distance in meters between two lat/lng points
+func haversine(lat1, lng1, lat2, lng2 float64) float64 {
+	const R = 6371000.0 // Earth radius in meters
+	lat1Rad := lat1 * math.Pi / 180.0
+	lat2Rad := lat2 * math.Pi / 180.0
+	dLat := (lat2 - lat1) * math.Pi / 180.0
+	dLng := (lng2 - lng1) * math.Pi / 180.0
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
+			math.Sin(dLng/2)*math.Sin(dLng/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return R * c
+}
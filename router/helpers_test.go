@@ -0,0 +1,233 @@
+package router
+
+import (
+	"bike-router/entities"
+	"bike-router/router/routertest"
+	"math"
+	"slices"
+	"testing"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// profile returns points one after the other with the given elevations
+func profile(elevations ...float64) []entities.Point {
+	points := make([]entities.Point, len(elevations))
+	for i, e := range elevations {
+		points[i] = entities.Point{Lat: 37.77 + float64(i)*0.001, Lng: -122.42, Elevation: e}
+	}
+	return points
+}
+
+func TestElevationTotals(t *testing.T) {
+	setupRouter(t)
+	downhillThresholdMeters = 1
+
+	tests := []struct {
+		name            string
+		elevations      []float64
+		ascent, descent float64
+	}{
+		{"empty", nil, 0, 0},
+		{"single point", []float64{10}, 0, 0},
+		{"steady climb", []float64{0, 5, 10, 20}, 20, 0},
+		{"climb in sub-threshold steps", []float64{0, 0.6, 1.2, 1.8, 2.4}, 2.4, 0},
+		{"noise on flat ground", []float64{10, 10.5, 9.8, 10.4, 9.9, 10}, 0, 0},
+		{"loop counts both ways", []float64{0, 30, 0}, 30, 30},
+		{"descent then climb", []float64{50, 40, 45, 60}, 20, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ascent, descent := elevationTotals(profile(tt.elevations...))
+			if math.Abs(ascent-tt.ascent) > 1e-9 || math.Abs(descent-tt.descent) > 1e-9 {
+				t.Errorf("elevationTotals(%v) = %.2f up, %.2f down; want %.2f, %.2f",
+					tt.elevations, ascent, descent, tt.ascent, tt.descent)
+			}
+		})
+	}
+}
+
+func TestMaxClimbGrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		meters     []float64 // along the route, heading north
+		elevations []float64
+		want       float64
+	}{
+		{"flat", []float64{0, 100}, []float64{0, 0}, 0},
+		{"steady climb", []float64{0, 50, 100}, []float64{0, 5, 10}, 10},
+		{"descent only", []float64{0, 100}, []float64{10, 0}, 0},
+		{"1 m segment of noise", []float64{0, 1, 101}, []float64{0, 3, 3}, 3.0 / 101 * 100},
+		{"steep stretch at the end", []float64{0, 100, 125}, []float64{0, 0, 5}, 20},
+		{"route shorter than a run", []float64{0, 10}, []float64{0, 1}, 10},
+		{"wall capped", []float64{0, 20, 40}, []float64{0, 20, 20}, maxPlausibleGrade},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := make([]entities.Point, len(tt.meters))
+			for i, m := range tt.meters {
+				points[i] = entities.Point{Lat: 37.77 + m/6371000*180/math.Pi, Lng: -122.42, Elevation: tt.elevations[i]}
+			}
+			if got := maxClimbGrade(points); math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("maxClimbGrade() = %.2f%%, want %.2f%%", got, tt.want)
+			}
+		})
+	}
+}
+
+// latElevations answers each location with its latitude as the elevation, so
+// a result out of order is easy to spot
+func latElevations(r *maps.ElevationRequest) ([]maps.ElevationResult, error) {
+	results := make([]maps.ElevationResult, len(r.Locations))
+	for i, ll := range r.Locations {
+		results[i] = maps.ElevationResult{Elevation: ll.Lat}
+	}
+	return results, nil
+}
+
+func TestElevationsChunksLargeRequests(t *testing.T) {
+	setupRouter(t)
+	client := &routertest.MapsClient{ElevationFunc: latElevations}
+
+	locations := make([]entities.Coordinates, 1100)
+	for i := range locations {
+		locations[i] = entities.Coordinates{Lat: float64(i) / 100, Lng: 10}
+	}
+	elevations, err := Elevations(t.Context(), client, locations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range elevations {
+		if e != locations[i].Lat {
+			t.Fatalf("elevations[%d] = %v, want %v", i, e, locations[i].Lat)
+		}
+	}
+
+	var sizes []int
+	for _, r := range client.ElevationRequests() {
+		sizes = append(sizes, len(r.Locations))
+	}
+	if want := []int{512, 512, 76}; !slices.Equal(sizes, want) {
+		t.Errorf("request sizes = %v, want %v", sizes, want)
+	}
+
+	// Everything is cached now: a second lookup makes no calls
+	if _, err := Elevations(t.Context(), client, locations[:600]); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(client.ElevationRequests()); n != 3 {
+		t.Errorf("%d Elevation calls after a fully cached lookup, want still 3", n)
+	}
+}
+
+func TestElevationsRejectsShortAnswer(t *testing.T) {
+	setupRouter(t)
+	client := &routertest.MapsClient{ElevationFunc: func(r *maps.ElevationRequest) ([]maps.ElevationResult, error) {
+		return make([]maps.ElevationResult, len(r.Locations)-1), nil
+	}}
+	if _, err := Elevations(t.Context(), client, []entities.Coordinates{{Lat: 1, Lng: 1}, {Lat: 2, Lng: 2}}); err == nil {
+		t.Error("Elevations accepted fewer results than locations")
+	}
+}
+
+func TestFillElevationsFallsBackPerPoint(t *testing.T) {
+	setupRouter(t)
+	client := &routertest.MapsClient{ElevationFunc: func(r *maps.ElevationRequest) ([]maps.ElevationResult, error) {
+		if len(r.Locations) > 1 {
+			return nil, nil // a batch answered with nothing
+		}
+		return latElevations(r)
+	}}
+	points := profile(0, 0, 0)
+	fillElevations(t.Context(), client, points)
+	for i, p := range points {
+		if p.Elevation != p.Lat {
+			t.Errorf("points[%d].Elevation = %v, want %v", i, p.Elevation, p.Lat)
+		}
+	}
+}
+
+func TestExtractStreetNameFromHTML(t *testing.T) {
+	tests := []struct {
+		html, language, want string
+	}{
+		{"Turn <b>left</b> onto <b>Market St</b>", "", "Market St"},
+		{"Head <b>north</b> on <b>Main St</b> toward <b>1st Ave</b>", "", "Main St"},
+		{"Head <b>north</b> toward <b>Main St</b>", "", "Main St"},
+		{"Continue onto <b>Valencia St</b>", "", "Valencia St"},
+		{"Slight <b>right</b> to stay on <b>Main St</b>", "en-GB", "Main St"},
+		{"Turn <b>left</b> onto <b>Market St</b><div style=\"font-size:0.9em\">Destination will be on the right</div>", "", "Market St"},
+		{"Turn <b>left</b><div style=\"font-size:0.9em\">Destination will be on the <b>right</b></div>", "", ""},
+		{"At the roundabout, take the <b>2nd</b> exit onto <b>Oak &amp; Pine Rd</b>", "", "Oak & Pine Rd"},
+		{"Turn <b>right</b> onto <b>The Embarcadero</b>/<wbr/><b>CA-1</b>", "", "The Embarcadero"},
+		{"Head <b>northwest</b>", "", ""},
+		{"Keep <b>left</b> at the fork", "", ""},
+		// No keywords for German: the caller falls back to reverse geocoding
+		{"Links abbiegen auf <b>Hauptstraße</b>", "de", ""},
+	}
+	for _, tt := range tests {
+		if got := extractStreetNameFromHTML(tt.html, tt.language); got != tt.want {
+			t.Errorf("extractStreetNameFromHTML(%q, %q) = %q, want %q", tt.html, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveZigZags(t *testing.T) {
+	// North 20 m, back 15 m, then on 95 m: a 180° hop at the second point,
+	// ending 5 m from where it started
+	north := func(meters ...float64) []entities.Point {
+		points := make([]entities.Point, len(meters))
+		for i, m := range meters {
+			points[i] = entities.Point{Lat: 37.77 + m/111320, Lng: -122.42}
+		}
+		return points
+	}
+	route := north(0, 20, 5, 100)
+
+	tests := []struct {
+		name         string
+		minBacktrack float64
+		preserveTurn float64
+		want         []entities.Point
+	}{
+		{"removes the hop", 30, 0, north(0, 5, 100)},
+		{"longer than the limit", 4, 0, route},
+		{"zero disables", 0, 0, route},
+		{"negative disables", -1, 0, route},
+		{"sharp turn preserved", 30, 150, route},
+		{"turn not past the preserve angle", 30, 180, north(0, 5, 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeZigZags(route, tt.minBacktrack, tt.preserveTurn); !slices.Equal(got, tt.want) {
+				t.Errorf("removeZigZags() kept %d of %d points, want %d", len(got), len(route), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestEstimateStopCount(t *testing.T) {
+	tests := []struct {
+		name          string
+		htmls         []string
+		intersections int
+		want          int
+	}{
+		{"turn words in street names", []string{"Continue onto <b>New Jersey Turnpike</b>", "Continue onto <b>Exit Rd</b>"}, 0, 0},
+		{"slight and sharp turns", []string{"Slight <b>left</b> onto <b>Oak St</b>", "Sharp <b>right</b> onto <b>Pine St</b>"}, 0, 2},
+		{"head and continue straight", []string{"Head <b>north</b> on <b>Market St</b>", "Continue straight past <b>Oak St</b>"}, 0, 0},
+		{"intersections add up", []string{"Turn <b>left</b> onto <b>Oak St</b>", "Keep <b>right</b> at the fork"}, 3, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instructions := []entities.Instruction{}
+			for _, html := range tt.htmls {
+				instructions = append(instructions, entities.Instruction{Instruction: html, Maneuver: inferManeuver(html, "", 0)})
+			}
+			instructions = append(instructions, entities.Instruction{Instruction: "Arrive at Oak St", Maneuver: "arrive"})
+			if got := estimateStopCount(instructions, tt.intersections); got != tt.want {
+				t.Errorf("estimateStopCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// keyPool holds one Maps client per API key and hands them out in
+// round-robin order. A key that used up its quota sits out
+// config.MapsKeyCooldown so the others carry the load meanwhile; one that
+// was only rate limited sits out a retry backoff.
+type keyPool struct {
+	clients []*maps.Client
+
+	mu           sync.Mutex
+	next         int
+	benchedUntil []time.Time // per client; zero when usable
+}
+
+func newKeyPool(clients []*maps.Client) *keyPool {
+	return &keyPool{clients: clients, benchedUntil: make([]time.Time, len(clients))}
+}
+
+// errKeysOverQuota is returned without calling Google while every key is
+// cooling down for longer than a retry would wait
+var errKeysOverQuota = errors.New("maps: OVER_QUERY_LIMIT - every API key is over quota")
+
+// pick returns the index of the next client in rotation that isn't cooling
+// down; when all are, the one whose cooldown ends first, as long as that is
+// no further off than a retry would wait. ok is false otherwise.
+func (p *keyPool) pick() (i int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	best := -1
+	for range p.clients {
+		i := p.next
+		p.next = (p.next + 1) % len(p.clients)
+		if !now.Before(p.benchedUntil[i]) {
+			return i, true
+		}
+		if best < 0 || p.benchedUntil[i].Before(p.benchedUntil[best]) {
+			best = i
+		}
+	}
+	return best, p.benchedUntil[best].Sub(now) <= mapsRetry.maxDelay
+}
+
+// usable counts the clients that aren't cooling down, or only for as long as
+// a retry would wait
+func (p *keyPool) usable() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, until := range p.benchedUntil {
+		if until.Sub(now) <= mapsRetry.maxDelay {
+			n++
+		}
+	}
+	return n
+}
+
+// bench takes a client out of rotation after the quota error err, for as long
+// as quotaCooldown says. It reports whether another key is usable right away.
+func (p *keyPool) bench(ctx context.Context, i int, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	cooldown := quotaCooldown(err)
+	p.benchedUntil[i] = now.Add(cooldown)
+	if len(p.clients) > 1 {
+		// Only the key's position, never the key itself
+		slog.WarnContext(ctx, "maps API key over quota, rotating", "key", i+1, "cooldown", cooldown.String())
+	}
+	for j := range p.clients {
+		if j != i && !now.Before(p.benchedUntil[j]) {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaCooldown is how long a key sits out after the quota error err. A used
+// up quota (OVER_DAILY_LIMIT, HTTP 429, or OVER_QUERY_LIMIT for the daily
+// quota) won't come back soon, so it gets config.MapsKeyCooldown. Any other
+// OVER_QUERY_LIMIT is a momentary queries-per-second limit, over by the time
+// a retry would wait.
+func quotaCooldown(err error) time.Duration {
+	if isTooManyRequests(err) {
+		return config.MapsKeyCooldown
+	}
+	switch mapsStatus(err) {
+	case "OVER_DAILY_LIMIT":
+		return config.MapsKeyCooldown
+	case "OVER_QUERY_LIMIT":
+		if strings.Contains(strings.ToLower(err.Error()), "daily") {
+			return config.MapsKeyCooldown
+		}
+	}
+	return mapsRetry.backoff(0)
+}
+
+// isQuotaError reports whether a Maps error means the key ran out of quota
+// rather than the request being at fault
+func isQuotaError(err error) bool {
+	switch mapsStatus(err) {
+	case "OVER_QUERY_LIMIT", "OVER_DAILY_LIMIT":
+		return true
+	}
+	return isTooManyRequests(err)
+}
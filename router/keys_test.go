@@ -0,0 +1,185 @@
+package router
+
+import (
+	"bike-router/router/routertest"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+var (
+	errQPS   = errors.New("maps: OVER_QUERY_LIMIT - You have exceeded your rate-limit for this API.")
+	errDaily = errors.New("maps: OVER_QUERY_LIMIT - You have exceeded your daily request quota for this API.")
+)
+
+// testKeyPool is a pool of n distinct clients that are never called
+func testKeyPool(n int) *keyPool {
+	clients := make([]*maps.Client, n)
+	for i := range clients {
+		clients[i] = new(maps.Client)
+	}
+	return newKeyPool(clients)
+}
+
+func setupKeys(t *testing.T) {
+	t.Helper()
+	setupRouter(t)
+	config.MapsKeyCooldown = time.Minute
+	mapsRetry = retryPolicy{maxAttempts: 3, baseDelay: time.Millisecond, maxDelay: 10 * time.Millisecond}
+}
+
+func TestKeyPoolPick(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   int
+		bench  map[int]error
+		want   []int
+		wantOK bool
+	}{
+		{"round robin", 3, nil, []int{0, 1, 2, 0, 1}, true},
+		{"skips a used up key", 3, map[int]error{1: errDaily}, []int{0, 2, 0, 2}, true},
+		{"skips a rate-limited key", 2, map[int]error{0: errQPS}, []int{1, 1}, true},
+		{"single key rate limited", 1, map[int]error{0: errQPS}, []int{0}, true},
+		{"every key used up", 2, map[int]error{0: errDaily, 1: &upstreamStatusError{StatusCode: 429}}, nil, false},
+		{"single key used up", 1, map[int]error{0: errors.New("maps: OVER_DAILY_LIMIT - ")}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupKeys(t)
+			pool := testKeyPool(tt.keys)
+			for i, err := range tt.bench {
+				pool.bench(t.Context(), i, err)
+			}
+			if !tt.wantOK {
+				if i, ok := pool.pick(); ok {
+					t.Errorf("pick() = %d, want none usable", i)
+				}
+				return
+			}
+			var got []int
+			for range tt.want {
+				i, ok := pool.pick()
+				if !ok {
+					t.Fatal("pick() found no usable key")
+				}
+				got = append(got, i)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapsAdapterSingleKeyRateLimited(t *testing.T) {
+	setupKeys(t)
+	adapter := mapsAdapter{keys: testKeyPool(1)}
+	calls := 0
+	err := adapter.do(t.Context(), func(*maps.Client) error {
+		if calls++; calls == 1 {
+			return errQPS
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("do() = %v after %d calls, want success on the retry", err, calls)
+	}
+}
+
+func TestQuotaCooldown(t *testing.T) {
+	setupKeys(t)
+	tests := []struct {
+		name string
+		err  error
+		long bool
+	}{
+		{"per-second limit", errQPS, false},
+		{"daily quota", errDaily, true},
+		{"daily limit", errors.New("maps: OVER_DAILY_LIMIT - "), true},
+		{"HTTP 429", &upstreamStatusError{StatusCode: 429}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := quotaCooldown(tt.err)
+			if long := got == config.MapsKeyCooldown; long != tt.long || got > config.MapsKeyCooldown {
+				t.Errorf("quotaCooldown() = %s, want the key cooldown: %v", got, tt.long)
+			}
+		})
+	}
+}
+
+func TestMapsAdapterRotatesKeys(t *testing.T) {
+	setupKeys(t)
+	pool := testKeyPool(2)
+	adapter := mapsAdapter{keys: pool}
+	index := map[*maps.Client]int{pool.clients[0]: 0, pool.clients[1]: 1}
+
+	// Key 0 is used up: the call moves on to key 1 without a retry
+	var called []int
+	err := adapter.do(t.Context(), func(c *maps.Client) error {
+		called = append(called, index[c])
+		if index[c] == 0 {
+			return errDaily
+		}
+		return nil
+	})
+	if err != nil || !slices.Equal(called, []int{0, 1}) {
+		t.Fatalf("do() = %v after calling keys %v, want success on 0 then 1", err, called)
+	}
+
+	// Then key 1 is used up too: the retry finds no key left to call, and
+	// neither does the next call
+	called = nil
+	err = adapter.do(t.Context(), func(c *maps.Client) error {
+		called = append(called, index[c])
+		return errDaily
+	})
+	if !errors.Is(err, errKeysOverQuota) || !slices.Equal(called, []int{1}) {
+		t.Fatalf("do() = %v after calling keys %v, want errKeysOverQuota after key 1", err, called)
+	}
+	called = nil
+	err = adapter.do(t.Context(), func(c *maps.Client) error {
+		called = append(called, index[c])
+		return nil
+	})
+	if !errors.Is(err, errKeysOverQuota) || len(called) != 0 {
+		t.Errorf("do() = %v after calling keys %v, want errKeysOverQuota and no call", err, called)
+	}
+	if code := UpstreamErrorCode(err); code != "over_quota" {
+		t.Errorf("UpstreamErrorCode() = %q, want over_quota", code)
+	}
+}
+
+func TestKeyStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       int
+		bench      map[int]error
+		wantUsable int
+	}{
+		{"all usable", 3, nil, 3},
+		{"one used up", 3, map[int]error{1: errDaily}, 2},
+		{"rate limited still counts", 2, map[int]error{0: errQPS, 1: errQPS}, 2},
+		{"all used up", 2, map[int]error{0: errDaily, 1: errDaily}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupKeys(t)
+			pool := testKeyPool(tt.keys)
+			for i, err := range tt.bench {
+				pool.bench(t.Context(), i, err)
+			}
+			usable, total := KeyStatus(mapsAdapter{keys: pool})
+			if usable != tt.wantUsable || total != tt.keys {
+				t.Errorf("KeyStatus() = %d of %d, want %d of %d", usable, total, tt.wantUsable, tt.keys)
+			}
+		})
+	}
+
+	if usable, total := KeyStatus(&routertest.MapsClient{}); usable != 1 || total != 1 {
+		t.Errorf("KeyStatus(fake) = %d of %d, want 1 of 1", usable, total)
+	}
+}
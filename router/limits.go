@@ -0,0 +1,77 @@
+package router
+
+import (
+	"bike-router/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// apiLimiter bounds how many calls to one Maps API are in flight at once,
+// across all requests. Each API gets its own pool because their quotas differ.
+type apiLimiter chan struct{}
+
+func newAPILimiter(size int) apiLimiter {
+	if size < 1 {
+		size = 1
+	}
+	return make(apiLimiter, size)
+}
+
+// acquire waits for a free slot, giving up when the request is cancelled
+func (l apiLimiter) acquire(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l apiLimiter) release() { <-l }
+
+const defaultAPIConcurrency = 10
+
+var (
+	elevationLimiter = newAPILimiter(defaultAPIConcurrency)
+	geocodeLimiter   = newAPILimiter(defaultAPIConcurrency)
+)
+
+// errRateLimited marks a Maps call that couldn't get a token from the rate
+// limiter before its request's deadline
+var errRateLimited = errors.New("maps rate limit exceeded")
+
+// rateLimitTransport spaces out all Maps API calls with a token bucket, so
+// bursts of requests stay within the project's queries-per-second quota
+type rateLimitTransport struct {
+	limiter *rate.Limiter
+	base    http.RoundTripper
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		// Wait fails early when the token would only come after the deadline
+		return nil, fmt.Errorf("%w: %v", errRateLimited, err)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Transport builds the Maps client's transport: upstream 429/5xx become
+// errors, and with a positive MAPS_RATE_LIMIT the calls are throttled first
+func Transport(cfg utils.Config) http.RoundTripper {
+	var base http.RoundTripper = http.DefaultTransport
+	if cfg.MapsRateLimit > 0 {
+		burst := cfg.MapsRateBurst
+		if burst < 1 {
+			burst = max(1, int(cfg.MapsRateLimit))
+		}
+		base = rateLimitTransport{limiter: rate.NewLimiter(rate.Limit(cfg.MapsRateLimit), burst), base: base}
+	}
+	return statusErrorTransport{base: base}
+}
@@ -0,0 +1,124 @@
+package router
+
+import (
+	"math"
+	"strings"
+)
+
+type maneuverPhrase struct {
+	phrase, maneuver string
+}
+
+// maneuverPhrases map instruction wording to Google's maneuver names, by base
+// language and most specific first; "" is no maneuver, as Google reports for
+// steps that follow the road however it bends. The Go client doesn't decode
+// the Directions API's step.maneuver, so it is recovered from the text Google
+// does return. Instructions in a language without an entry are read from the
+// turn angle alone.
+var maneuverPhrases = map[string][]maneuverPhrase{
+	"en": {
+		{"u-turn", "uturn"},
+		{"roundabout", "roundabout"},
+		{"traffic circle", "roundabout"},
+		{"slight left", "turn-slight-left"},
+		{"slight right", "turn-slight-right"},
+		{"sharp left", "turn-sharp-left"},
+		{"sharp right", "turn-sharp-right"},
+		{"keep left", "keep-left"},
+		{"keep right", "keep-right"},
+		{"fork", "fork"},
+		{"ramp", "ramp"},
+		{"exit", "ramp"},
+		{"merge", "merge"},
+		{"ferry", "ferry"},
+		{"turn left", "turn-left"},
+		{"turn right", "turn-right"},
+		{"continue straight", "straight"},
+		{"head", ""},
+		{"continue", ""},
+	},
+}
+
+// inferManeuver names the maneuver an instruction describes, in Google's
+// vocabulary (turn-left, keep-right, roundabout-left, ...), from the phrases
+// of the instruction's language found as whole words before the street name.
+// Maneuvers that need a side take it from the text, then from the sign of the
+// turn angle. Wording it doesn't recognize falls back to the turn angle alone;
+// "" means no maneuver.
+func inferManeuver(htmlInst, language string, turnAngle float64) string {
+	text := maneuverText(htmlInst, language)
+	for _, p := range maneuverPhrases[baseLanguage(language)] {
+		if !containsWord(text, p.phrase) {
+			continue
+		}
+		switch p.maneuver {
+		case "uturn", "roundabout", "fork", "ramp":
+			return p.maneuver + "-" + sideOf(text, turnAngle)
+		}
+		return p.maneuver
+	}
+
+	switch abs := math.Abs(turnAngle); {
+	case abs >= 150:
+		return "uturn-" + sideOf("", turnAngle)
+	case abs >= 110:
+		return "turn-sharp-" + sideOf("", turnAngle)
+	case abs >= 60:
+		return "turn-" + sideOf("", turnAngle)
+	case abs >= 30:
+		return "turn-slight-" + sideOf("", turnAngle)
+	}
+	return ""
+}
+
+// maneuverText is the lowercased instruction up to where the street is
+// named, so streets such as "Ferry St" or "Merge Rd" aren't read as
+// maneuvers. Google's trailing <div> notes are dropped too.
+func maneuverText(htmlInst, language string) string {
+	if idx := strings.Index(asciiLower(htmlInst), "<div"); idx >= 0 {
+		htmlInst = htmlInst[:idx]
+	}
+	text := asciiLower(stripHTML(htmlInst))
+	end := len(text)
+	for _, keyword := range streetKeywordsFor(language) {
+		if idx := strings.Index(text, keyword); idx >= 0 && idx < end {
+			end = idx
+		}
+	}
+	return text[:end]
+}
+
+// containsWord reports whether phrase occurs in text as whole words, so
+// "fork" doesn't match "Forkland"
+func containsWord(text, phrase string) bool {
+	for offset := 0; ; {
+		idx := strings.Index(text[offset:], phrase)
+		if idx < 0 {
+			return false
+		}
+		start, end := offset+idx, offset+idx+len(phrase)
+		if (start == 0 || !isLetter(text[start-1])) && (end == len(text) || !isLetter(text[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// sideOf reads left or right from the text, else from the turn angle
+// (positive is right)
+func sideOf(text string, turnAngle float64) string {
+	left, right := strings.Index(text, "left"), strings.Index(text, "right")
+	switch {
+	case left >= 0 && (right < 0 || left < right):
+		return "left"
+	case right >= 0:
+		return "right"
+	case turnAngle < 0:
+		return "left"
+	}
+	return "right"
+}
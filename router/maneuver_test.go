@@ -0,0 +1,44 @@
+package router
+
+import "testing"
+
+func TestInferManeuver(t *testing.T) {
+	tests := []struct {
+		name      string
+		language  string
+		html      string
+		turnAngle float64
+		want      string
+	}{
+		{"turn right", "", "Turn <b>right</b> onto <b>Valencia St</b>", 90, "turn-right"},
+		{"slight left", "", "Slight <b>left</b> toward <b>Market St</b>", -30, "turn-slight-left"},
+		{"keep right at fork", "", "Keep <b>right</b> at the fork", 10, "keep-right"},
+		{"fork", "", "At the fork, take the <b>left</b> path", -10, "fork-left"},
+		{"roundabout", "", "At the roundabout, take the <b>2nd</b> exit onto <b>Oak St</b>", 20, "roundabout-right"},
+		{"u-turn", "", "Make a <b>U-turn</b>", -170, "uturn-left"},
+		{"ferry", "", "Take the ferry", 0, "ferry"},
+		{"merge", "", "Merge onto <b>US-101 S</b>", 0, "merge"},
+		{"exit", "", "Take exit <b>5</b> toward <b>Trenton</b>", 10, "ramp-right"},
+		{"head", "", "Head <b>north</b> on <b>Market St</b>", 0, ""},
+		{"regional English", "en-GB", "Turn <b>left</b> onto <b>High St</b>", -90, "turn-left"},
+		{"other language by angle", "de", "Rechts abbiegen auf <b>Hauptstraße</b>", 85, "turn-right"},
+		{"English words in another language", "fr", "Prendre le ferry", 0, ""},
+
+		// Street names that contain maneuver words
+		{"onto Ferry St", "", "Turn <b>right</b> onto <b>Ferry St</b>", 90, "turn-right"},
+		{"onto Merge Rd", "", "Turn <b>left</b> onto <b>Merge Rd</b>", -90, "turn-left"},
+		{"onto Exit Rd", "", "Continue onto <b>Exit Rd</b>", 0, ""},
+		{"onto a Turnpike", "", "Continue onto <b>New Jersey Turnpike</b>", 0, ""},
+		{"on Forkland Dr", "", "Head <b>west</b> on <b>Forkland Dr</b>", 0, ""},
+		{"toward Roundabout Ave", "", "Continue toward <b>Roundabout Ave</b>", 5, ""},
+		{"Forkland without keyword", "", "Forkland Dr", 0, ""},
+		{"destination note", "", "Turn <b>left</b> onto <b>Oak St</b><div>Take the ferry to the island</div>", -90, "turn-left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inferManeuver(tt.html, tt.language, tt.turnAngle); got != tt.want {
+				t.Errorf("inferManeuver(%q, %q, %v) = %q, want %q", tt.html, tt.language, tt.turnAngle, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package router
+
+import (
+	"bike-router/entities"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// joinToleranceMeters is how close consecutive routes' ends must be for the
+// shared point to be emitted once
+const joinToleranceMeters = 1.0
+
+// MergeRoutes concatenates points and instructions, shifting each route's
+// cumulative distance/duration by the totals of the routes before it, and
+// recomputes the fields derived from them across the joins: elevation flags
+// and totals, distance markers (in the first route's units), bounds, stop
+// count and hash.
+func MergeRoutes(routes []entities.Route) entities.Route {
+	merged := entities.Route{ID: 1, Units: routes[0].Units}
+	distanceOffset, timeOffset := 0, 0
+	intersections := 0
+
+	for _, rt := range routes {
+		points := rt.Points
+		if n := len(merged.Points); n > 0 && len(points) > 0 {
+			last := merged.Points[n-1]
+			if haversine(last.Lat, last.Lng, points[0].Lat, points[0].Lng) < joinToleranceMeters {
+				points = points[1:]
+			}
+		}
+		merged.Points = append(merged.Points, points...)
+
+		for _, inst := range rt.Instructions {
+			inst.DistanceMeters += distanceOffset
+			inst.DurationSeconds += timeOffset
+			merged.Instructions = append(merged.Instructions, inst)
+		}
+
+		// The arrival instruction carries the route's running totals
+		if n := len(rt.Instructions); n > 0 {
+			distanceOffset += rt.Instructions[n-1].DistanceMeters
+			timeOffset += rt.Instructions[n-1].DurationSeconds
+		}
+		merged.TotalDistanceMeters += rt.TotalDistanceMeters
+		merged.TotalDurationSeconds += rt.TotalDurationSeconds
+		merged.DestinationAddress = rt.DestinationAddress
+
+		// The intersections aren't sent back, but are what the route's stop
+		// count has on top of its turns
+		intersections += max(rt.StopCount-estimateStopCount(rt.Instructions, 0), 0)
+	}
+
+	markDownhill(merged.Points)
+	assignGrades(merged.Points)
+	assignPointIndices(&merged)
+	merged.TotalAscentMeters, merged.TotalDescentMeters = elevationTotals(merged.Points)
+	merged.DistanceMarkers = distanceMarkers(merged.Points, markerIntervalMeters(merged.Units))
+	merged.StopCount = estimateStopCount(merged.Instructions, intersections)
+	merged.Bounds = routeBounds(maps.Route{}, merged.Points, false)
+	merged.Hash = routeHash(merged)
+	return merged
+}
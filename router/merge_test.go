@@ -0,0 +1,56 @@
+package router
+
+import (
+	"bike-router/entities"
+	"testing"
+
+	maps "googlemaps.github.io/maps"
+)
+
+func TestMergeRoutesDerivedFields(t *testing.T) {
+	setupRouter(t)
+	point := func(ll maps.LatLng) entities.Point { return entities.Point{Lat: ll.Lat, Lng: ll.Lng} }
+	far := maps.LatLng{Lat: testCorner.Lat, Lng: -122.4020} // about 1.4 km east of the corner
+
+	// The first route's stop count has one intersection on top of its turn
+	first := entities.Route{
+		Units:  unitsMetric,
+		Points: []entities.Point{point(testOrigin), point(testCorner)},
+		Instructions: []entities.Instruction{
+			{Instruction: "Head north on Market St"},
+			{Instruction: "Turn right onto Valencia St", Maneuver: "turn-right", DistanceMeters: 60},
+			{Instruction: "Arrive at Valencia St", Maneuver: "arrive", DistanceMeters: 111},
+		},
+		StopCount: 2,
+		Hash:      "first",
+	}
+	second := entities.Route{
+		Units:  unitsMetric,
+		Points: []entities.Point{point(testCorner), point(far)},
+		Instructions: []entities.Instruction{
+			{Instruction: "Head east on Valencia St"},
+			{Instruction: "Turn left onto 14th St", Maneuver: "turn-left", DistanceMeters: 700},
+			{Instruction: "Arrive at 14th St", Maneuver: "arrive", DistanceMeters: 1400},
+		},
+		StopCount: 1,
+		Hash:      "second",
+	}
+
+	merged := MergeRoutes([]entities.Route{first, second})
+	if merged.StopCount != 3 {
+		t.Errorf("StopCount = %d, want 3 (two turns and one intersection)", merged.StopCount)
+	}
+	if len(merged.DistanceMarkers) != 1 || merged.DistanceMarkers[0].Value != 1 {
+		t.Errorf("DistanceMarkers = %+v, want one at 1 km", merged.DistanceMarkers)
+	}
+	wantBounds := entities.Bounds{
+		NorthEast: entities.Coordinates{Lat: testCorner.Lat, Lng: far.Lng},
+		SouthWest: entities.Coordinates{Lat: testOrigin.Lat, Lng: testOrigin.Lng},
+	}
+	if merged.Bounds != wantBounds {
+		t.Errorf("Bounds = %+v, want %+v", merged.Bounds, wantBounds)
+	}
+	if merged.Hash != routeHash(merged) {
+		t.Errorf("Hash = %q, want the merged route's hash %q", merged.Hash, routeHash(merged))
+	}
+}
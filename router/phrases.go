@@ -0,0 +1,91 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// Phrase types for instructions the service writes itself
+const (
+	phraseArrive      = "arrive"      // final instruction of each leg
+	phraseDestination = "destination" // name used when the end point has no street
+	phraseContinue    = "continue"    // step without instructions, heading straight on
+	phraseTurnLeft    = "turn-left"   // step without instructions, turning left
+	phraseTurnRight   = "turn-right"  // step without instructions, turning right
+)
+
+// synthesizedTurnDegrees is the heading change above which a step without
+// instructions is described as a turn rather than continuing
+const synthesizedTurnDegrees = 30.0
+
+// PhraseData is the data available to phrase templates
+type PhraseData struct {
+	Street string
+}
+
+// defaultPhrases are the phrases by base language, then phrase type. A
+// language without an entry gets the English ones.
+var defaultPhrases = map[string]map[string]string{
+	"en": {
+		phraseArrive:      "Arrive at {{.Street}}",
+		phraseDestination: "Destination",
+		phraseContinue:    "Continue{{with .Street}} on <b>{{.}}</b>{{end}}",
+		phraseTurnLeft:    "Turn <b>left</b>{{with .Street}} onto <b>{{.}}</b>{{end}}",
+		phraseTurnRight:   "Turn <b>right</b>{{with .Street}} onto <b>{{.}}</b>{{end}}",
+	},
+}
+
+// phraseTemplates are the parsed phrases, keyed like defaultPhrases
+var phraseTemplates = map[string]map[string]*template.Template{}
+
+// loadPhraseTemplates parses the default phrases, replacing any that have an
+// override configured in every language
+func loadPhraseTemplates(overrides map[string]string) error {
+	for language, phrases := range defaultPhrases {
+		templates := map[string]*template.Template{}
+		for kind, text := range phrases {
+			if override := overrides[kind]; override != "" {
+				text = override
+			}
+			tmpl, err := template.New(kind).Parse(text)
+			if err != nil {
+				return fmt.Errorf("phrase template %q: %w", kind, err)
+			}
+			templates[kind] = tmpl
+		}
+		phraseTemplates[language] = templates
+	}
+	return nil
+}
+
+// renderPhrase renders a phrase in the given Google language, falling back to
+// the street name if the template fails at runtime
+func renderPhrase(kind, language string, data PhraseData) string {
+	templates, ok := phraseTemplates[baseLanguage(language)]
+	if !ok {
+		templates = phraseTemplates["en"]
+	}
+	tmpl, ok := templates[kind]
+	if !ok {
+		return data.Street
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return data.Street
+	}
+	return buf.String()
+}
+
+// synthesizeInstruction writes an HTML instruction, in the style of Google's,
+// for a step that came without one
+func synthesizeInstruction(turnAngle float64, street, language string) string {
+	kind := phraseContinue
+	switch {
+	case turnAngle > synthesizedTurnDegrees:
+		kind = phraseTurnRight
+	case turnAngle < -synthesizedTurnDegrees:
+		kind = phraseTurnLeft
+	}
+	return renderPhrase(kind, language, PhraseData{Street: street})
+}
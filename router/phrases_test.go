@@ -0,0 +1,56 @@
+package router
+
+import "testing"
+
+func TestPhraseTemplateOverride(t *testing.T) {
+	setupRouter(t)
+	if err := loadPhraseTemplates(map[string]string{"arrive": "Ride to {{.Street}}"}); err != nil {
+		t.Fatal(err)
+	}
+	req := validInput()
+	ApplyDefaults(&req)
+
+	out, err := BuildRoute(t.Context(), testClient(testRoute()), req, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instructions := out.Routes[0].Instructions
+	if got := instructions[len(instructions)-1].Instruction; got != "Ride to Valencia St" {
+		t.Errorf("arrival instruction = %q, want %q", got, "Ride to Valencia St")
+	}
+}
+
+func TestSynthesizedInstructionOverride(t *testing.T) {
+	setupRouter(t)
+	if err := loadPhraseTemplates(map[string]string{
+		"turn-left": "Left{{with .Street}} to {{.}}{{end}}",
+		"continue":  "Straight on",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		angle    float64
+		street   string
+		language string
+		want     string
+	}{
+		{-90, "Oak St", "", "Left to Oak St"},
+		{-90, "", "", "Left"},
+		{5, "Oak St", "", "Straight on"},
+		{90, "Oak St", "", "Turn <b>right</b> onto <b>Oak St</b>"},      // not overridden
+		{-90, "Oak St", "de", "Left to Oak St"},                         // overrides apply in every language
+		{90, "Oak St", "pt-BR", "Turn <b>right</b> onto <b>Oak St</b>"}, // no phrases of its own
+	}
+	for _, tt := range tests {
+		if got := synthesizeInstruction(tt.angle, tt.street, tt.language); got != tt.want {
+			t.Errorf("synthesizeInstruction(%v, %q, %q) = %q, want %q", tt.angle, tt.street, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestPhraseTemplateInvalid(t *testing.T) {
+	setupRouter(t)
+	if err := loadPhraseTemplates(map[string]string{"arrive": "Arrive at {{.Street"}); err == nil {
+		t.Error("loadPhraseTemplates accepted an unparseable template")
+	}
+}
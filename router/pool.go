@@ -0,0 +1,44 @@
+package router
+
+import (
+	"context"
+	"sync"
+)
+
+const defaultLookupWorkers = 4
+
+// lookupAll calls lookup for every input on up to workers goroutines and
+// returns the results in input order. Once ctx is done no new lookups start;
+// their results stay zero. The per-API limiters still cap the calls in
+// flight across all requests.
+func lookupAll[In, Out any](ctx context.Context, inputs []In, workers int, lookup func(context.Context, In) Out) []Out {
+	results := make([]Out, len(inputs))
+	if workers < 1 {
+		workers = 1
+	}
+	workers = min(workers, len(inputs))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = lookup(ctx, inputs[i])
+			}
+		}()
+	}
+
+feed:
+	for i := range inputs {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
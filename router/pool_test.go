@@ -0,0 +1,71 @@
+package router
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupAllKeepsInputOrder(t *testing.T) {
+	inputs := make([]int, 50)
+	for i := range inputs {
+		inputs[i] = i
+	}
+	// Later inputs finish first, so results arrive out of order
+	results := lookupAll(t.Context(), inputs, 8, func(_ context.Context, in int) int {
+		time.Sleep(time.Duration(len(inputs)-in) * 100 * time.Microsecond)
+		return in * in
+	})
+	for i, got := range results {
+		if got != i*i {
+			t.Fatalf("results[%d] = %d, want %d", i, got, i*i)
+		}
+	}
+}
+
+func TestLookupAllBoundsWorkers(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	lookupAll(t.Context(), make([]int, 20), 3, func(context.Context, int) int {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		inFlight.Add(-1)
+		return 0
+	})
+	if got := peak.Load(); got > 3 {
+		t.Errorf("%d lookups ran at once, want at most 3", got)
+	}
+}
+
+func TestLookupAllStopsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	var calls atomic.Int32
+	results := lookupAll(ctx, make([]int, 100), 2, func(context.Context, int) int {
+		if calls.Add(1) == 4 {
+			cancel()
+		}
+		return 1
+	})
+	if got := calls.Load(); got >= 100 {
+		t.Fatalf("%d lookups ran after cancellation, want fewer than 100", got)
+	}
+	done := 0
+	for _, r := range results {
+		done += r
+	}
+	if done != int(calls.Load()) {
+		t.Errorf("%d results set for %d lookups; lookups never started must stay zero", done, calls.Load())
+	}
+}
+
+func TestLookupAllEmpty(t *testing.T) {
+	if got := lookupAll(t.Context(), nil, 4, func(context.Context, int) int { return 1 }); len(got) != 0 {
+		t.Errorf("lookupAll(nil) = %v, want empty", got)
+	}
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// retryPolicy is how transient Maps API failures are retried: exponential
+// backoff from baseDelay, capped at maxDelay, for up to maxAttempts calls
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	// jitter randomizes each wait between half and all of the backoff, so
+	// instances that hit the quota together don't all retry together
+	jitter bool
+}
+
+var mapsRetry = retryPolicy{maxAttempts: 3, baseDelay: 200 * time.Millisecond, maxDelay: 5 * time.Second, jitter: true}
+
+// backoff is the wait after the given failed attempt (0-based)
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.baseDelay << attempt
+	if d <= 0 || d > p.maxDelay {
+		d = p.maxDelay
+	}
+	if p.jitter && d > 1 {
+		d = d/2 + rand.N(d/2)
+	}
+	return d
+}
+
+// withRetry runs call until it succeeds, fails with a non-retryable error,
+// runs out of attempts or ctx is done. It returns the last error.
+func withRetry(ctx context.Context, p retryPolicy, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || !isRetryable(err) || attempt+1 >= p.maxAttempts || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-time.After(p.backoff(attempt)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// isRetryable reports whether a Maps error is worth another try: rate
+// limiting, server errors and network timeouts. Bad requests and key
+// problems fail fast.
+func isRetryable(err error) bool {
+	if errors.Is(err, errKeysOverQuota) {
+		// Nothing will have changed by the next attempt
+		return false
+	}
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// Statuses Google reports inside a 200 response
+	msg := err.Error()
+	return strings.Contains(msg, "OVER_QUERY_LIMIT") || strings.Contains(msg, "UNKNOWN_ERROR")
+}
+
+// upstreamStatusError is a 429 or 5xx from a Maps API, surfaced as an error by
+// statusErrorTransport. The client library would otherwise try to decode the
+// error page as JSON and report a parse error instead.
+type upstreamStatusError struct {
+	StatusCode int
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("maps: HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+type statusErrorTransport struct {
+	base http.RoundTripper
+}
+
+func (t statusErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, &upstreamStatusError{StatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
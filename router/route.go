@@ -0,0 +1,724 @@
+// Package router turns a RouteInput into cycling routes: it asks Google for
+// directions, then names, simplifies and annotates every route. It knows
+// nothing about HTTP; the server in package main is a thin wrapper around it.
+package router
+
+import (
+	"bike-router/entities"
+	"bike-router/utils"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// MapsClient is the part of *maps.Client the router calls, so the pipeline
+// can be driven by a fake in tests. NewMapsClient adapts the real client.
+type MapsClient interface {
+	Directions(ctx context.Context, r *maps.DirectionsRequest) ([]maps.Route, []maps.GeocodedWaypoint, error)
+	Elevation(ctx context.Context, r *maps.ElevationRequest) ([]maps.ElevationResult, error)
+	Geocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error)
+	ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error)
+}
+
+// Options are the per-request switches that aren't part of RouteInput (the
+// server reads them from the query string)
+type Options struct {
+	Debug            bool    // Raw and simplified point counts
+	Handoff          bool    // Routing-engine handoff payload
+	Boundaries       bool    // Mark administrative boundary crossings
+	Decoded          bool    // Full-resolution step geometry
+	MaxSegmentMeters float64 // Densify so no segment is longer; 0 disables
+}
+
+// config holds the deployment settings the pipeline reads, set by Configure
+var config = utils.Config{MaxWaypoints: 10, CarCO2GramsPerKm: 110, LookupWorkers: defaultLookupWorkers}
+
+// Configure applies the deployment settings: limits, caches, retries,
+// thresholds, phrase templates and the weather provider. Call it once at
+// startup, before serving.
+func Configure(cfg utils.Config) error {
+	if err := loadPhraseTemplates(cfg.PhraseTemplates); err != nil {
+		return err
+	}
+
+	config = cfg
+	elevationLimiter = newAPILimiter(cfg.ElevationConcurrency)
+	geocodeLimiter = newAPILimiter(cfg.GeocodeConcurrency)
+	configureCaches(cfg)
+	downhillThresholdMeters = cfg.DownhillThresholdMeters
+	mapsRetry = retryPolicy{
+		maxAttempts: cfg.MapsMaxAttempts,
+		baseDelay:   cfg.RetryBaseDelay,
+		maxDelay:    cfg.RetryMaxDelay,
+		jitter:      cfg.RetryJitter,
+	}
+
+	if cfg.WeatherProvider == "open-meteo" {
+		weatherProvider = newOpenMeteoProvider()
+	}
+	return nil
+}
+
+// travelModes maps RouteInput.Mode to the Directions API travel mode
+var travelModes = map[string]maps.Mode{
+	"walking":   maps.TravelModeWalking,
+	"bicycling": maps.TravelModeBicycling,
+	"driving":   maps.TravelModeDriving,
+	"transit":   maps.TravelModeTransit,
+}
+
+const defaultTravelMode = "bicycling"
+
+// directionsAvoid maps the RouteInput.Avoid values Google handles itself to
+// the Directions API restrictions; "unpaved" is filtered afterwards instead
+var directionsAvoid = map[string]maps.Avoid{
+	"highways": maps.AvoidHighways,
+	"tolls":    maps.AvoidTolls,
+	"ferries":  maps.AvoidFerries,
+	"indoor":   maps.Avoid("indoor"), // no library constant; Google documents it for walking and transit
+}
+
+// Validate checks a RouteInput before any Maps call is made. Failures are
+// InputErrors, whose text tells the client what to fix.
+func Validate(req entities.RouteInput) error {
+	switch req.Verbosity {
+	case "", entities.VerbosityMinimal, entities.VerbosityNormal, entities.VerbosityVerbose:
+	default:
+		return InputError("invalid verbosity: must be minimal, normal or verbose")
+	}
+
+	if req.Origin == nil && strings.TrimSpace(req.OriginAddress) == "" {
+		return InputError("Origin or OriginAddress is required")
+	}
+
+	if req.DestinationCoords == nil && strings.TrimSpace(req.Destination) == "" {
+		return InputError("Destination or DestinationCoords is required")
+	}
+
+	if req.Origin != nil {
+		if err := req.Origin.Validate(); err != nil {
+			return InputError("invalid Origin: " + err.Error())
+		}
+	}
+	if req.DestinationCoords != nil {
+		if err := req.DestinationCoords.Validate(); err != nil {
+			return InputError("invalid DestinationCoords: " + err.Error())
+		}
+	}
+	for i, wp := range req.Waypoints {
+		if err := wp.Validate(); err != nil {
+			return InputError(fmt.Sprintf("invalid waypoint %d: %s", i+1, err))
+		}
+	}
+
+	if _, ok := travelModes[req.Mode]; req.Mode != "" && !ok {
+		return InputError(fmt.Sprintf("invalid mode %q: must be walking, bicycling, driving or transit", req.Mode))
+	}
+
+	if len(req.Waypoints) > config.MaxWaypoints {
+		return InputError(fmt.Sprintf("too many waypoints: %d given, at most %d allowed", len(req.Waypoints), config.MaxWaypoints))
+	}
+
+	if req.Leg < 0 || req.Leg > len(req.Waypoints)+1 {
+		return InputError(fmt.Sprintf("invalid leg %d: the trip has %d legs", req.Leg, len(req.Waypoints)+1))
+	}
+
+	if req.PreserveTurnDegrees < 0 || req.PreserveTurnDegrees > 180 {
+		return InputError("PreserveTurnDegrees must be between 0 and 180")
+	}
+
+	if req.ElevationSamplesPerKm < 0 {
+		return InputError("elevationSamplesPerKm must not be negative")
+	}
+
+	if req.RiderWeightKg < 0 || req.RiderWeightKg > maxRiderWeightKg {
+		return InputError(fmt.Sprintf("RiderWeightKg must be between 0 and %g", maxRiderWeightKg))
+	}
+
+	if req.BatteryWh > 0 && req.AssistLevel != "" {
+		if _, ok := assistShare[req.AssistLevel]; !ok {
+			return InputError("invalid assist level: must be eco, tour, sport or turbo")
+		}
+	}
+
+	for _, avoid := range req.Avoid {
+		if _, ok := directionsAvoid[avoid]; !ok && avoid != avoidUnpaved {
+			return InputError(fmt.Sprintf("invalid avoid value %q: must be highways, tolls, ferries, indoor or unpaved", avoid))
+		}
+	}
+
+	if _, ok := directionsUnits[req.Units]; req.Units != "" && !ok {
+		return InputError(fmt.Sprintf("invalid units %q: must be metric or imperial", req.Units))
+	}
+
+	switch req.Simplify {
+	case "", simplifyDistance, simplifyDouglasPeucker:
+	default:
+		return InputError(fmt.Sprintf("invalid simplify value %q: must be distance or douglas-peucker", req.Simplify))
+	}
+	for _, t := range []struct {
+		name  string
+		value float64
+	}{{"SimplifyMeters", req.SimplifyMeters}, {"ZigZagMeters", max(req.ZigZagMeters, 0)}, {"SimplifyEpsilonMeters", req.SimplifyEpsilonMeters}} {
+		// A negative ZigZagMeters turns zig-zag removal off
+		if t.value < 0 || t.value > maxThresholdMeters {
+			return InputError(fmt.Sprintf("%s must be between 0 and %g", t.name, maxThresholdMeters))
+		}
+	}
+
+	switch req.Prefer {
+	case "", preferBikeLanes:
+	default:
+		return InputError(fmt.Sprintf("invalid prefer value %q: must be bikelanes", req.Prefer))
+	}
+
+	if !req.DepartureTime.IsZero() && !req.ArrivalTime.IsZero() {
+		return InputError("set DepartureTime or ArrivalTime, not both")
+	}
+	return nil
+}
+
+// ApplyDefaults fills in the values the pipeline would otherwise assume, so
+// the input echoed back (?echo=true) shows exactly what produced the result
+func ApplyDefaults(req *entities.RouteInput) {
+	if req.Mode == "" {
+		req.Mode = defaultTravelMode
+	}
+	if req.SimplifyMeters == 0 {
+		req.SimplifyMeters = defaultSimplifyMeters
+	}
+	if req.ZigZagMeters == 0 {
+		req.ZigZagMeters = defaultZigZagMeters
+	}
+	if req.Simplify == "" {
+		req.Simplify = simplifyDistance
+	}
+	if req.Simplify == simplifyDouglasPeucker && req.SimplifyEpsilonMeters == 0 {
+		req.SimplifyEpsilonMeters = defaultSimplifyEpsilonMeters
+	}
+	if req.Units == "" {
+		req.Units = unitsMetric
+	}
+	if req.Verbosity == "" {
+		req.Verbosity = entities.VerbosityNormal
+	}
+	if req.DepartureTime.IsZero() && req.ArrivalTime.IsZero() {
+		req.DepartureTime.Time = time.Now()
+	}
+	if req.BatteryWh > 0 && req.AssistLevel == "" {
+		req.AssistLevel = defaultAssistLevel
+	}
+}
+
+// Endpoints returns the origin and destination as sent to Google: "lat,lng"
+// when coordinates were given, otherwise the address
+func Endpoints(req entities.RouteInput) (origin, destination string) {
+	origin = req.OriginAddress
+	if req.Origin != nil {
+		origin = fmt.Sprintf("%f,%f", req.Origin.Lat, req.Origin.Lng)
+	}
+	destination = req.Destination
+	if req.DestinationCoords != nil {
+		destination = fmt.Sprintf("%f,%f", req.DestinationCoords.Lat, req.DestinationCoords.Lng)
+	}
+	return origin, destination
+}
+
+// directionsRequest builds the Directions API request for a validated input
+func directionsRequest(req entities.RouteInput) *maps.DirectionsRequest {
+	origin, destination := Endpoints(req)
+	dr := &maps.DirectionsRequest{
+		Origin:      origin,
+		Destination: destination,
+		Mode:        travelModes[req.Mode],
+		// Preferring bike lanes needs alternatives to choose between
+		Alternatives: req.Alternatives || req.Prefer == preferBikeLanes,
+		Units:        directionsUnits[req.Units],
+		Language:     req.Language,
+	}
+	for _, wp := range req.Waypoints {
+		dr.Waypoints = append(dr.Waypoints, fmt.Sprintf("%f,%f", wp.Lat, wp.Lng))
+	}
+	// Only transit is scheduled; for the other modes the times just set the
+	// clock times, and a past departure would make Google reject driving
+	if dr.Mode == maps.TravelModeTransit {
+		if !req.DepartureTime.IsZero() {
+			dr.DepartureTime = strconv.FormatInt(req.DepartureTime.Unix(), 10)
+		}
+		if !req.ArrivalTime.IsZero() {
+			dr.ArrivalTime = strconv.FormatInt(req.ArrivalTime.Unix(), 10)
+		}
+	}
+	for _, avoid := range req.Avoid {
+		if a, ok := directionsAvoid[avoid]; ok && !slices.Contains(dr.Avoid, a) {
+			dr.Avoid = append(dr.Avoid, a)
+		}
+	}
+	return dr
+}
+
+// walkingRequest is the same trip on foot; walking isn't scheduled, so the
+// transit times are dropped
+func walkingRequest(dr *maps.DirectionsRequest) *maps.DirectionsRequest {
+	walk := *dr
+	walk.Mode = maps.TravelModeWalking
+	walk.DepartureTime, walk.ArrivalTime = "", ""
+	walk.TransitMode, walk.TransitRoutingPreference = nil, ""
+	return &walk
+}
+
+// directions fetches Google's routes, failing with ErrNoRoutes when there are none
+func directions(ctx context.Context, client MapsClient, dr *maps.DirectionsRequest) ([]maps.Route, error) {
+	routesResp, _, err := client.Directions(ctx, dr)
+	if err != nil {
+		return nil, &DirectionsError{Err: err}
+	}
+	if len(routesResp) == 0 {
+		return nil, ErrNoRoutes
+	}
+	return routesResp, nil
+}
+
+// Summarize describes each route from Google's totals and one sampled
+// elevation request, without the per-step lookups of BuildRoute. The routes
+// go through the same selectRoutes as BuildRoute's, judged on the sampled
+// elevations and Google's step text, so a summary describes the routes the
+// full response would return.
+func Summarize(ctx context.Context, client MapsClient, req entities.RouteInput) (entities.RouteSummaryOutput, error) {
+	routesResp, err := directions(ctx, client, directionsRequest(req))
+	if err != nil {
+		return entities.RouteSummaryOutput{}, err
+	}
+
+	summaries := make(map[int]entities.RouteSummary, len(routesResp))
+	profiles := make([]entities.Route, 0, len(routesResp))
+	for i, rt := range routesResp {
+		summary, samples := buildRouteSummary(ctx, client, i+1, rt, req.ElevationSamplesPerKm)
+		summaries[summary.ID] = summary
+		profiles = append(profiles, entities.Route{
+			ID:                summary.ID,
+			Points:            samples,
+			Instructions:      stepInstructions(rt),
+			TotalAscentMeters: summary.ElevationGainMeters,
+		})
+	}
+	if ctx.Err() != nil {
+		return entities.RouteSummaryOutput{}, ctx.Err()
+	}
+
+	selected, err := selectRoutes(profiles, req)
+	if err != nil {
+		return entities.RouteSummaryOutput{}, err
+	}
+	out := entities.RouteSummaryOutput{Routes: make([]entities.RouteSummary, 0, len(selected))}
+	for _, profile := range selected {
+		out.Routes = append(out.Routes, summaries[profile.ID])
+	}
+	return out, nil
+}
+
+// BuildRoute runs the whole pipeline for a validated input with defaults
+// applied: directions, street names, elevations, simplification, and the
+// filters and annotations the input asks for. Every Maps call shares ctx, and
+// a cancelled ctx is returned as its error.
+func BuildRoute(ctx context.Context, client MapsClient, req entities.RouteInput, opts Options) (entities.RouteOutput, error) {
+	dr := directionsRequest(req)
+	routesResp, err := directions(ctx, client, dr)
+	fallbackMode := ""
+	if errors.Is(err, ErrNoRoutes) && req.TransitFallback && dr.Mode == maps.TravelModeTransit {
+		// Usually a schedule gap: walk the whole trip rather than fail,
+		// and say so on every route
+		dr = walkingRequest(dr)
+		fallbackMode = "walking"
+		routesResp, err = directions(ctx, client, dr)
+	}
+	if err != nil {
+		return entities.RouteOutput{}, err
+	}
+
+	out := entities.RouteOutput{Routes: make([]entities.Route, 0, len(routesResp))}
+	var window rideWindow
+	for i, rt := range routesResp {
+		route, err := buildRoute(ctx, client, req, opts, dr, i+1, rt)
+		if err != nil {
+			return entities.RouteOutput{}, err
+		}
+		route.FallbackMode = fallbackMode
+		out.Routes = append(out.Routes, route)
+		window.add(departureTime(req, rt), time.Duration(route.TotalDurationSeconds)*time.Second)
+	}
+
+	// One forecast serves every alternative: they share the start, and the
+	// window runs from the earliest departure to the latest arrival
+	if legs := routesResp[0].Legs; weatherProvider != nil && len(legs) >= max(req.Leg, 1) {
+		// The resolved start of the trip or selected leg, which also
+		// covers address origins
+		start := legs[max(req.Leg, 1)-1].StartLocation
+		if forecast, ok := rideForecast(ctx, start.Lat, start.Lng, window); ok {
+			for i := range out.Routes {
+				out.Routes[i].Advisories = weatherAdvisories(out.Routes[i], forecast)
+			}
+		}
+	}
+
+	out.Routes, err = selectRoutes(out.Routes, req)
+	if err != nil {
+		return entities.RouteOutput{}, err
+	}
+
+	for i := range out.Routes {
+		out.Routes[i].Instructions = filterInstructions(out.Routes[i].Instructions, req.Verbosity)
+	}
+	return out, nil
+}
+
+// selectRoutes drops the routes that break the rider's limits, keeping the
+// alternatives that pass, then with Prefer=bikelanes picks one of those. It
+// runs on built routes and on the sampled profiles of summaries alike, so
+// both choose the same route.
+func selectRoutes(routes []entities.Route, req entities.RouteInput) ([]entities.Route, error) {
+	if req.MaxElevationGainMeters > 0 {
+		routes = filterRoutes(routes, func(rt entities.Route) bool {
+			return rt.TotalAscentMeters <= req.MaxElevationGainMeters
+		})
+		if len(routes) == 0 {
+			return nil, NoMatchingRouteError(fmt.Sprintf("no route climbs less than %.0f m", req.MaxElevationGainMeters))
+		}
+	}
+	if req.MaxGradePercent > 0 {
+		routes = filterRoutes(routes, func(rt entities.Route) bool {
+			return maxClimbGrade(rt.Points) <= req.MaxGradePercent
+		})
+		if len(routes) == 0 {
+			return nil, NoMatchingRouteError(fmt.Sprintf("no route stays under a %.1f%% grade", req.MaxGradePercent))
+		}
+	}
+	if slices.Contains(req.Avoid, avoidUnpaved) {
+		routes = filterRoutes(routes, func(rt entities.Route) bool {
+			return !mentionsUnpaved(rt.Instructions)
+		})
+		if len(routes) == 0 {
+			return nil, NoMatchingRouteError("no route avoids unpaved sections")
+		}
+	}
+
+	if req.Prefer == preferBikeLanes {
+		routes = []entities.Route{mostBikeLanes(routes)}
+	}
+	return routes, nil
+}
+
+// buildRoute turns one of Google's routes into the response route
+func buildRoute(ctx context.Context, client MapsClient, req entities.RouteInput, opts Options, dr *maps.DirectionsRequest, id int, rt maps.Route) (entities.Route, error) {
+	// With a leg selected, the link and polyline cover that leg only
+	legDR := legRequest(dr, req.Leg)
+	route := entities.Route{ID: id, GoogleMapsURL: googleMapsURL(legDR), OverviewPolyline: legOverviewPolyline(rt, req.Leg)}
+	if opts.Handoff {
+		route.Handoff = routingHandoff(rt, dr.Mode, req.Leg)
+	}
+	if opts.Decoded {
+		route.DecodedPolyline = decodeStepPolylines(rt, req.Leg)
+	}
+	points := []entities.Point{}
+	instructions := []entities.Instruction{}
+
+	cumulativeDistance := 0
+	cumulativeTime := 0
+	intersections := 0
+	areas := map[string]adminArea{} // by coordKey, for boundary crossings
+	var prevStep *maps.Step
+
+	// Reverse-geocode every step start and leg end up front, in parallel;
+	// the loop below only reads the results
+	geocoded := prefetchGeocodes(ctx, client, rt, req)
+
+	for legIndex, leg := range rt.Legs {
+		// A single requested leg starts from zero, as if it were the whole trip
+		if req.Leg > 0 && legIndex+1 != req.Leg {
+			continue
+		}
+		route.TotalDistanceMeters += leg.Distance.Meters
+		route.TotalDurationSeconds += int(leg.Duration.Seconds())
+
+		var lastDesc string
+		legFirstInstruction, legStartDistance := len(instructions), cumulativeDistance
+		for _, step := range legSteps(leg, req.Verbosity) {
+			if ctx.Err() != nil {
+				return entities.Route{}, ctx.Err()
+			}
+
+			lat := step.StartLocation.Lat
+			lng := step.StartLocation.Lng
+
+			// Extract instruction from Google
+			htmlInst := step.HTMLInstructions
+			distanceMeters := step.Distance.Meters
+			durationSecs := int(step.Duration.Seconds())
+
+			// Steps with no text and no extent carry nothing to follow
+			if strings.TrimSpace(htmlInst) == "" && distanceMeters == 0 && durationSecs == 0 {
+				continue
+			}
+
+			// Signed turn from the previous step's heading onto this one
+			turnAngle := 0.0
+			if prevStep != nil {
+				_, incoming := stepBearings(prevStep)
+				outgoing, _ := stepBearings(step)
+				turnAngle = turnAngleDegrees(incoming, outgoing)
+			}
+			prevStep = step
+
+			results := geocoded[coordKey(lat, lng)]
+
+			// Some (often transit) sub-steps come without instructions:
+			// describe them from the turn and the reverse-geocoded street
+			if strings.TrimSpace(htmlInst) == "" {
+				htmlInst = synthesizeInstruction(turnAngle, routeNameFromGeocode(results), req.Language)
+			}
+
+			// Extract street name from HTML instruction. Phrasing the
+			// parser doesn't know (e.g. a language without keywords)
+			// falls back to the reverse-geocoded street before the raw
+			// instruction text.
+			streetName := extractStreetNameFromHTML(htmlInst, req.Language)
+			nameSource := entities.NameSourceManeuverHTML
+			if streetName == "" {
+				streetName = routeNameFromGeocode(results)
+				nameSource = entities.NameSourceReverseGeocode
+			}
+			if streetName == "" {
+				streetName = stripHTML(htmlInst)
+				nameSource = entities.NameSourceFallback
+			}
+
+			// Build instruction object
+			instruction := entities.Instruction{
+				Instruction:     htmlInst,
+				DistanceMeters:  cumulativeDistance,
+				DurationSeconds: cumulativeTime,
+				Maneuver:        inferManeuver(htmlInst, req.Language, turnAngle),
+				StreetName:      streetName,
+				NameSource:      nameSource,
+				TurnAngle:       turnAngle,
+				TravelMode:      strings.ToLower(step.TravelMode),
+				StartLocation:   entities.Coordinates{Lat: lat, Lng: lng},
+			}
+			instructions = append(instructions, instruction)
+
+			// Instructions report the distance to where their step
+			// starts, so this step only counts towards the next one
+			cumulativeDistance += distanceMeters
+			cumulativeTime += durationSecs
+
+			// Prefer clean street name from reverse geocode
+			if geocodeHasType(results, "intersection") {
+				intersections++
+			}
+			// The origin is often the rider's home: only use its street,
+			// never the building-level address or place
+			isOrigin := len(instructions) == 1
+			placeID := placeIDFromGeocode(results)
+			desc := streetNameFromGeocode(results)
+			if isOrigin {
+				desc = routeNameFromGeocode(results)
+				placeID = routePlaceIDFromGeocode(results)
+			}
+			descSource := entities.NameSourceReverseGeocode
+			if desc == "" {
+				desc = stripHTML(htmlInst)
+				descSource = entities.NameSourceFallback
+			}
+
+			// Skip repeated or empty street names
+			if desc == "" || desc == lastDesc {
+				continue
+			}
+			lastDesc = desc
+
+			areas[coordKey(lat, lng)] = adminAreaFromGeocode(results)
+			points = append(points, entities.Point{
+				Lat:         lat,
+				Lng:         lng,
+				Description: desc,
+				NameSource:  descSource,
+				PlaceID:     placeID,
+				Elevation:   0, // filled in per route below
+				IsDownHill:  false,
+
+				IsIntersection: isIntersection(results),
+			})
+		}
+
+		// Add final destination instruction
+		endLat := leg.EndLocation.Lat
+		endLng := leg.EndLocation.Lng
+		endResults := geocoded[coordKey(endLat, endLng)]
+		endDesc := streetNameFromGeocode(endResults)
+		endSource := entities.NameSourceReverseGeocode
+		if endDesc == "" {
+			endDesc = renderPhrase(phraseDestination, req.Language, PhraseData{})
+			endSource = entities.NameSourceFallback
+		}
+
+		arrive := entities.Instruction{
+			Instruction:     renderPhrase(phraseArrive, req.Language, PhraseData{Street: endDesc}),
+			DistanceMeters:  cumulativeDistance,
+			DurationSeconds: cumulativeTime,
+			Maneuver:        "arrive",
+			StreetName:      endDesc,
+			NameSource:      endSource,
+			StartLocation:   entities.Coordinates{Lat: endLat, Lng: endLng},
+		}
+
+		// A zero-length last step starts where the leg ends: it becomes
+		// the arrival rather than being followed by a duplicate one. Only
+		// this leg's steps qualify; a leg ending where it starts keeps the
+		// previous leg's arrival.
+		if n := len(instructions); n > legFirstInstruction &&
+			isCoincident(instructions[n-1].StartLocation.Lat, instructions[n-1].StartLocation.Lng, endLat, endLng) {
+			arrive.TurnAngle = instructions[n-1].TurnAngle
+			arrive.TravelMode = instructions[n-1].TravelMode
+			instructions[n-1] = arrive
+		} else {
+			instructions = append(instructions, arrive)
+		}
+
+		if config.ReconcileLegDistances {
+			reconcileLegDistances(instructions[legFirstInstruction:], legStartDistance,
+				cumulativeDistance-legStartDistance, leg.Distance.Meters)
+			cumulativeDistance = legStartDistance + leg.Distance.Meters
+		}
+
+		// The last leg's end is the route destination
+		route.DestinationAddress = addressFromGeocode(endResults)
+
+		// Add final leg point
+		areas[coordKey(endLat, endLng)] = adminAreaFromGeocode(endResults)
+		endPoint := entities.Point{
+			Lat:         endLat,
+			Lng:         endLng,
+			Description: endDesc,
+			NameSource:  endSource,
+			PlaceID:     placeIDFromGeocode(endResults),
+			Elevation:   0,
+			IsDownHill:  false,
+
+			IsIntersection: isIntersection(endResults),
+		}
+		if n := len(points); n > 0 && isCoincident(points[n-1].Lat, points[n-1].Lng, endLat, endLng) {
+			points[n-1] = endPoint
+		} else {
+			points = append(points, endPoint)
+		}
+	}
+
+	// One batched Elevation API call for every point of the route
+	fillElevations(ctx, client, points)
+	if ctx.Err() != nil {
+		return entities.Route{}, ctx.Err()
+	}
+
+	// Step 1: simplify close points (<50 m by default), or keep the shape
+	// within a tolerance with Douglas-Peucker
+	var simplified []entities.Point
+	if req.Simplify == simplifyDouglasPeucker {
+		simplified = douglasPeucker(points, req.SimplifyEpsilonMeters)
+	} else {
+		simplified = simplifyRoute(points, req.SimplifyMeters, req.PreserveTurnDegrees)
+	}
+
+	// Step 2: remove micro backtracks or “zig-zags”
+	simplified = removeZigZags(simplified, req.ZigZagMeters, req.PreserveTurnDegrees)
+
+	// Step 3: merge duplicates
+	simplified = mergeDuplicateDescriptions(simplified)
+
+	if opts.MaxSegmentMeters > 0 {
+		simplified = densifyRoute(simplified, opts.MaxSegmentMeters)
+	}
+
+	// Step 4: set downhill info
+	markDownhill(simplified)
+	assignGrades(simplified)
+
+	if opts.Boundaries {
+		markBoundaryCrossings(simplified, areas)
+	}
+
+	// Step 5: total climb, counted in both directions so loops
+	// don't cancel their ascent out with the return descent
+	route.TotalAscentMeters, route.TotalDescentMeters = elevationTotals(simplified)
+
+	if opts.Debug {
+		route.RawPointCount = len(points)
+		route.SimplifiedPointCount = len(simplified)
+	}
+
+	addAccessibleText(instructions)
+	addDistanceText(instructions, req.Units)
+	route.Units = req.Units
+	assignEstimatedTimes(instructions, departureTime(req, rt))
+	route.DistanceMarkers = distanceMarkers(simplified, markerIntervalMeters(req.Units))
+
+	route.Points = simplified
+	route.Instructions = instructions
+	route.StopCount = estimateStopCount(instructions, intersections)
+	if req.BatteryWh > 0 {
+		used := estimateBatteryWh(simplified, req.AssistLevel)
+		sufficient := used <= req.BatteryWh
+		route.EstimatedBatteryUsedWh = used
+		route.BatterySufficient = &sufficient
+	}
+	if req.RiderWeightKg > 0 {
+		route.EstimatedCalories = estimateCalories(dr.Mode, req.RiderWeightKg, time.Duration(route.TotalDurationSeconds)*time.Second, route.TotalAscentMeters)
+	}
+	if dr.Mode != maps.TravelModeDriving {
+		route.CO2SavedGrams = co2SavedGrams(cumulativeDistance, config.CarCO2GramsPerKm)
+	}
+	assignPointIndices(&route)
+	applyPrivacySnap(&route, rt, legDR, req.Leg, config)
+	route.Bounds = routeBounds(rt, route.Points, req.Leg == 0 && !config.SnapOrigin && !config.SnapDestination)
+	route.Hash = routeHash(route)
+	return route, nil
+}
+
+// prefetchGeocodes reverse-geocodes the start of every step, as legSteps
+// gives them, and the end of every leg (only req.Leg when set) on config.LookupWorkers
+// goroutines, keyed by coordKey. Failed lookups are left empty, as the
+// pipeline treats a location Google can't name.
+func prefetchGeocodes(ctx context.Context, client MapsClient, rt maps.Route, req entities.RouteInput) map[string][]maps.GeocodingResult {
+	var locations []maps.LatLng
+	seen := map[string]bool{}
+	add := func(ll maps.LatLng) {
+		if key := coordKey(ll.Lat, ll.Lng); !seen[key] {
+			seen[key] = true
+			locations = append(locations, ll)
+		}
+	}
+	for legIndex, leg := range rt.Legs {
+		if req.Leg > 0 && legIndex+1 != req.Leg {
+			continue
+		}
+		for _, step := range legSteps(leg, req.Verbosity) {
+			add(step.StartLocation)
+		}
+		add(leg.EndLocation)
+	}
+
+	results := lookupAll(ctx, locations, config.LookupWorkers, func(ctx context.Context, ll maps.LatLng) []maps.GeocodingResult {
+		resp, _ := reverseGeocode(ctx, client, ll.Lat, ll.Lng, req.Language)
+		return resp
+	})
+	geocoded := make(map[string][]maps.GeocodingResult, len(locations))
+	for i, ll := range locations {
+		geocoded[coordKey(ll.Lat, ll.Lng)] = results[i]
+	}
+	return geocoded
+}
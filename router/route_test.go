@@ -0,0 +1,436 @@
+package router
+
+import (
+	"bike-router/entities"
+	"bike-router/router/routertest"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+func coords(ll maps.LatLng) *entities.Coordinates {
+	return &entities.Coordinates{Lat: ll.Lat, Lng: ll.Lng}
+}
+
+func validInput() entities.RouteInput {
+	return entities.RouteInput{Origin: coords(testOrigin), DestinationCoords: coords(testDestination)}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*entities.RouteInput)
+		wantErr string // substring; "" means valid
+	}{
+		{"valid", func(*entities.RouteInput) {}, ""},
+		{"no origin", func(r *entities.RouteInput) { r.Origin = nil }, "Origin or OriginAddress"},
+		{"address origin", func(r *entities.RouteInput) { r.Origin, r.OriginAddress = nil, "Ferry Building" }, ""},
+		{"no destination", func(r *entities.RouteInput) { r.DestinationCoords = nil }, "Destination or DestinationCoords"},
+		{"origin off the globe", func(r *entities.RouteInput) { r.Origin.Lat = 91 }, "invalid Origin"},
+		{"bad waypoint", func(r *entities.RouteInput) { r.Waypoints = []entities.Coordinates{{Lat: 0, Lng: 181}} }, "invalid waypoint 1"},
+		{"bad mode", func(r *entities.RouteInput) { r.Mode = "flying" }, "invalid mode"},
+		{"bad avoid", func(r *entities.RouteInput) { r.Avoid = []string{"hills"} }, "invalid avoid"},
+		{"unpaved avoid", func(r *entities.RouteInput) { r.Avoid = []string{"unpaved", "ferries"} }, ""},
+		{"both times", func(r *entities.RouteInput) {
+			r.DepartureTime.Time = testTime
+			r.ArrivalTime.Time = testTime
+		}, "DepartureTime"},
+		{"arrival only", func(r *entities.RouteInput) { r.ArrivalTime.Time = testTime }, ""},
+		{"zig-zags kept", func(r *entities.RouteInput) { r.ZigZagMeters = -1 }, ""},
+		{"zig-zag limit too high", func(r *entities.RouteInput) { r.ZigZagMeters = 501 }, "ZigZagMeters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validInput()
+			tt.modify(&req)
+			err := Validate(req)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() = %v, want an error mentioning %q", err, tt.wantErr)
+			case err != nil && !errors.As(err, new(InputError)):
+				t.Errorf("Validate() = %T, want an InputError", err)
+			}
+		})
+	}
+}
+
+func TestBuildRoute(t *testing.T) {
+	setupRouter(t)
+	client := testClient(testRoute())
+	req := validInput()
+	ApplyDefaults(&req)
+
+	out, err := BuildRoute(t.Context(), client, req, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Routes) != 1 {
+		t.Fatalf("got %d routes, want 1", len(out.Routes))
+	}
+	route := out.Routes[0]
+
+	var streets, maneuvers []string
+	for _, inst := range route.Instructions {
+		streets = append(streets, inst.StreetName)
+		maneuvers = append(maneuvers, inst.Maneuver)
+	}
+	if want := []string{"Market St", "Valencia St", "Valencia St"}; strings.Join(streets, "|") != strings.Join(want, "|") {
+		t.Errorf("street names = %q, want %q", streets, want)
+	}
+	if want := []string{"", "turn-right", "arrive"}; strings.Join(maneuvers, "|") != strings.Join(want, "|") {
+		t.Errorf("maneuvers = %q, want %q", maneuvers, want)
+	}
+	if route.TotalDistanceMeters != 234 || route.TotalDurationSeconds != 60 {
+		t.Errorf("totals = %d m, %d s; want 234 m, 60 s", route.TotalDistanceMeters, route.TotalDurationSeconds)
+	}
+	if last := route.Instructions[len(route.Instructions)-1]; last.DistanceMeters != 234 {
+		t.Errorf("arrival at %d m, want 234", last.DistanceMeters)
+	}
+
+	requests := client.DirectionsRequests()
+	if len(requests) != 1 {
+		t.Fatalf("%d Directions calls, want 1", len(requests))
+	}
+	if requests[0].Mode != maps.TravelModeBicycling {
+		t.Errorf("mode sent = %q, want bicycling", requests[0].Mode)
+	}
+}
+
+func TestBuildRouteArrival(t *testing.T) {
+	head := routertest.Step("Head <b>north</b> on <b>Market St</b>", testOrigin, testCorner, 111, 30*time.Second)
+	turn := routertest.Step("Turn <b>right</b> onto <b>Valencia St</b>", testCorner, testDestination, 123, 30*time.Second)
+
+	tests := []struct {
+		name string
+		rt   maps.Route
+		want []string // maneuvers
+	}{
+		{"arrival appended", routertest.Route(routertest.Leg(head, turn)), []string{"", "turn-right", "arrive"}},
+		{"zero-length last step becomes the arrival", routertest.Route(routertest.Leg(head, turn,
+			routertest.Step("Continue to <b>Valencia St</b>", testDestination, testDestination, 0, 0),
+		)), []string{"", "turn-right", "arrive"}},
+		{"zero-length leg keeps the previous arrival", routertest.Route(routertest.Leg(head, turn), routertest.Leg(
+			routertest.Step("", testDestination, testDestination, 0, 0),
+		)), []string{"", "turn-right", "arrive", "arrive"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupRouter(t)
+			req := validInput()
+			ApplyDefaults(&req)
+
+			out, err := BuildRoute(t.Context(), testClient(tt.rt), req, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var maneuvers []string
+			for _, inst := range out.Routes[0].Instructions {
+				maneuvers = append(maneuvers, inst.Maneuver)
+			}
+			if !slices.Equal(maneuvers, tt.want) {
+				t.Errorf("maneuvers = %q, want %q", maneuvers, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRouteNoRoutes(t *testing.T) {
+	setupRouter(t)
+	req := validInput()
+	ApplyDefaults(&req)
+	if _, err := BuildRoute(t.Context(), testClient(), req, Options{}); !errors.Is(err, ErrNoRoutes) {
+		t.Errorf("BuildRoute() = %v, want ErrNoRoutes", err)
+	}
+}
+
+func TestBuildRouteDirectionsError(t *testing.T) {
+	setupRouter(t)
+	client := testClient()
+	client.DirectionsFunc = func(*maps.DirectionsRequest) ([]maps.Route, error) {
+		return nil, errors.New("maps: REQUEST_DENIED - ")
+	}
+	req := validInput()
+	ApplyDefaults(&req)
+	_, err := BuildRoute(t.Context(), client, req, Options{})
+	var dirErr *DirectionsError
+	if !errors.As(err, &dirErr) {
+		t.Fatalf("BuildRoute() = %v, want a DirectionsError", err)
+	}
+}
+
+func TestBuildRoutePrivacySnap(t *testing.T) {
+	setupRouter(t)
+	config.SnapOrigin, config.SnapDestination, config.SnapDecimals = true, true, 3
+
+	origin := maps.LatLng{Lat: 37.77493, Lng: -122.41942}
+	nearOrigin := maps.LatLng{Lat: 37.77523, Lng: -122.41930}
+	corner := maps.LatLng{Lat: 37.77893, Lng: -122.41802}
+	destination := maps.LatLng{Lat: 37.77921, Lng: -122.41463}
+	first := routertest.Step("Head <b>north</b> on <b>Market St</b>", origin, corner, 460, time.Minute)
+	first.Polyline.Points = maps.Encode([]maps.LatLng{origin, nearOrigin, corner})
+	second := routertest.Step("Turn <b>right</b> onto <b>Valencia St</b>", corner, destination, 300, time.Minute)
+	second.Polyline.Points = maps.Encode([]maps.LatLng{corner, destination})
+	rt := routertest.Route(routertest.Leg(first, second))
+	rt.OverviewPolyline.Points = maps.Encode([]maps.LatLng{origin, nearOrigin, corner, destination})
+
+	client := testClient(rt)
+	client.ReverseGeocodeFunc = func(r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+		home := routertest.StreetResult("Market St")
+		home.PlaceID = "home-place"
+		home.FormattedAddress = "1455 Market St"
+		home.AddressComponents = append(home.AddressComponents, maps.AddressComponent{LongName: "1455", Types: []string{"street_number"}})
+		return []maps.GeocodingResult{home}, nil
+	}
+	req := validInput()
+	req.Origin, req.DestinationCoords = coords(origin), coords(destination)
+	ApplyDefaults(&req)
+
+	out, err := BuildRoute(t.Context(), client, req, Options{Handoff: true, Decoded: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{"37.77493", "122.41942", "37.77523", "122.4193", "37.77921", "122.41463", "1455", "home-place"} {
+		if strings.Contains(string(body), raw) {
+			t.Errorf("response contains %q, from an exact end", raw)
+		}
+	}
+	if !strings.Contains(string(body), "37.77893") {
+		t.Error("the corner, away from both ends, was snapped too")
+	}
+	path, err := maps.DecodePolyline(out.Routes[0].OverviewPolyline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ll := range path {
+		if ll == origin || ll == nearOrigin || ll == destination {
+			t.Errorf("overview polyline keeps %v", ll)
+		}
+	}
+}
+
+func TestBuildRouteTransitFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		fallback     bool
+		wantErr      error
+		wantModes    []maps.Mode
+		wantFallback string
+	}{
+		{"fallback walks", true, nil, []maps.Mode{maps.TravelModeTransit, maps.TravelModeWalking}, "walking"},
+		{"no fallback", false, ErrNoRoutes, []maps.Mode{maps.TravelModeTransit}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupRouter(t)
+			client := testClient()
+			client.DirectionsFunc = func(r *maps.DirectionsRequest) ([]maps.Route, error) {
+				if r.Mode == maps.TravelModeTransit {
+					return nil, nil // ZERO_RESULTS
+				}
+				if r.DepartureTime != "" {
+					t.Errorf("walking request kept departure time %q", r.DepartureTime)
+				}
+				return []maps.Route{testRoute()}, nil
+			}
+			req := validInput()
+			req.Mode, req.TransitFallback = "transit", tt.fallback
+			ApplyDefaults(&req)
+
+			out, err := BuildRoute(t.Context(), client, req, Options{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BuildRoute() = %v, want %v", err, tt.wantErr)
+			}
+			var modes []maps.Mode
+			for _, r := range client.DirectionsRequests() {
+				modes = append(modes, r.Mode)
+			}
+			if !slices.Equal(modes, tt.wantModes) {
+				t.Errorf("modes requested = %q, want %q", modes, tt.wantModes)
+			}
+			if err == nil && out.Routes[0].FallbackMode != tt.wantFallback {
+				t.Errorf("FallbackMode = %q, want %q", out.Routes[0].FallbackMode, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestBuildRouteLeg(t *testing.T) {
+	// Two legs through a waypoint at the corner; the second takes 2 minutes
+	first := routertest.Step("Head <b>north</b> on <b>Market St</b>", testOrigin, testCorner, 111, 30*time.Second)
+	first.Polyline.Points = maps.Encode([]maps.LatLng{testOrigin, testCorner})
+	second := routertest.Step("Turn <b>right</b> onto <b>Valencia St</b>", testCorner, testDestination, 123, 2*time.Minute)
+	second.Polyline.Points = maps.Encode([]maps.LatLng{testCorner, testDestination})
+	rt := routertest.Route(routertest.Leg(first), routertest.Leg(second))
+	rt.OverviewPolyline.Points = maps.Encode([]maps.LatLng{testOrigin, testCorner, testDestination})
+
+	origin := fmt.Sprintf("%f,%f", testOrigin.Lat, testOrigin.Lng)
+	corner := fmt.Sprintf("%f,%f", testCorner.Lat, testCorner.Lng)
+	destination := fmt.Sprintf("%f,%f", testDestination.Lat, testDestination.Lng)
+
+	tests := []struct {
+		name                   string
+		leg                    int
+		wantOrigin, wantDest   string
+		wantWaypoints          string
+		wantPathStart, wantEnd maps.LatLng
+		wantDepart             time.Time // of the first instruction, for arrival at testTime
+		wantHandoff            []maps.LatLng
+	}{
+		{"whole trip", 0, origin, destination, corner, testOrigin, testDestination, testTime.Add(-150 * time.Second), []maps.LatLng{testOrigin, testCorner, testDestination}},
+		{"first leg", 1, origin, corner, "", testOrigin, testCorner, testTime.Add(-150 * time.Second), []maps.LatLng{testOrigin, testCorner}},
+		{"second leg", 2, corner, destination, "", testCorner, testDestination, testTime.Add(-2 * time.Minute), []maps.LatLng{testCorner, testDestination}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupRouter(t)
+			weather := &fakeWeather{}
+			weatherProvider = weather
+			req := validInput()
+			req.Waypoints = []entities.Coordinates{*coords(testCorner)}
+			req.Leg = tt.leg
+			req.ArrivalTime.Time = testTime
+			ApplyDefaults(&req)
+
+			out, err := BuildRoute(t.Context(), testClient(rt), req, Options{Handoff: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			route := out.Routes[0]
+
+			var handoff []maps.LatLng
+			for _, c := range route.Handoff.Coordinates {
+				handoff = append(handoff, maps.LatLng{Lat: c[1], Lng: c[0]})
+			}
+			if !slices.Equal(handoff, tt.wantHandoff) {
+				t.Errorf("handoff = %v, want %v", handoff, tt.wantHandoff)
+			}
+
+			link, err := url.Parse(route.GoogleMapsURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := link.Query()
+			if q.Get("origin") != tt.wantOrigin || q.Get("destination") != tt.wantDest || q.Get("waypoints") != tt.wantWaypoints {
+				t.Errorf("link = %s to %s via %q, want %s to %s via %q",
+					q.Get("origin"), q.Get("destination"), q.Get("waypoints"), tt.wantOrigin, tt.wantDest, tt.wantWaypoints)
+			}
+
+			path, err := maps.DecodePolyline(route.OverviewPolyline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !nearLatLng(path[0], tt.wantPathStart) || !nearLatLng(path[len(path)-1], tt.wantEnd) {
+				t.Errorf("overview polyline runs %v to %v, want %v to %v", path[0], path[len(path)-1], tt.wantPathStart, tt.wantEnd)
+			}
+
+			if got := route.Instructions[0].EstimatedTime; got != tt.wantDepart.Format(time.RFC3339) {
+				t.Errorf("first instruction at %s, want %s", got, tt.wantDepart.Format(time.RFC3339))
+			}
+
+			if len(weather.locations) != 1 || weather.locations[0] != tt.wantPathStart {
+				t.Errorf("forecasts looked up at %v, want %v", weather.locations, tt.wantPathStart)
+			}
+		})
+	}
+}
+
+// nearLatLng reports whether two positions match to the polyline encoding's
+// precision
+func nearLatLng(a, b maps.LatLng) bool {
+	return math.Abs(a.Lat-b.Lat) < 1e-5 && math.Abs(a.Lng-b.Lng) < 1e-5
+}
+
+// straightRoute is one leg heading north, a step of 200 m per instruction
+func straightRoute(htmls ...string) maps.Route {
+	steps := make([]*maps.Step, len(htmls))
+	for i, html := range htmls {
+		from := maps.LatLng{Lat: testOrigin.Lat + float64(i)*0.002, Lng: testOrigin.Lng}
+		to := maps.LatLng{Lat: from.Lat + 0.002, Lng: from.Lng}
+		steps[i] = routertest.Step(html, from, to, 200, time.Minute)
+	}
+	return routertest.Route(routertest.Leg(steps...))
+}
+
+// turnTestRoute has real turns, and straight-on steps whose street names
+// contain turn words
+var turnTestRoute = []string{
+	"Head <b>north</b> on <b>Market St</b>",
+	"Slight <b>left</b> onto <b>Oak St</b>",
+	"Sharp <b>right</b> onto <b>Pine St</b>",
+	"Continue onto <b>New Jersey Turnpike</b>",
+	"Continue onto <b>Exit Rd</b>",
+	"Take exit <b>5</b> toward <b>Trenton</b>",
+}
+
+func TestBuildRouteVerbosity(t *testing.T) {
+	walk := routertest.Step("Walk to <b>Civic Center</b>", testOrigin, testDestination, 234, time.Minute)
+	walk.TravelMode = "WALKING"
+	walk.Steps = []*maps.Step{
+		routertest.Step("Head <b>north</b> on <b>Market St</b>", testOrigin, testCorner, 111, 30*time.Second),
+		routertest.Step("Turn <b>right</b> onto <b>Valencia St</b>", testCorner, testDestination, 123, 30*time.Second),
+	}
+
+	tests := []struct {
+		name      string
+		route     maps.Route
+		verbosity string
+		want      []string // instruction texts before the arrival
+	}{
+		{"minimal keeps turns", straightRoute(turnTestRoute...), entities.VerbosityMinimal, []string{turnTestRoute[1], turnTestRoute[2], turnTestRoute[5]}},
+		{"normal keeps every step", straightRoute(turnTestRoute...), entities.VerbosityNormal, turnTestRoute},
+		{"normal keeps a step whole", routertest.Route(routertest.Leg(walk)), entities.VerbosityNormal, []string{walk.HTMLInstructions}},
+		{"verbose splits sub-steps", routertest.Route(routertest.Leg(walk)), entities.VerbosityVerbose, []string{walk.Steps[0].HTMLInstructions, walk.Steps[1].HTMLInstructions}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupRouter(t)
+			req := validInput()
+			req.Verbosity = tt.verbosity
+			ApplyDefaults(&req)
+
+			out, err := BuildRoute(t.Context(), testClient(tt.route), req, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			instructions := out.Routes[0].Instructions
+			var got []string
+			for _, inst := range instructions[:len(instructions)-1] {
+				got = append(got, inst.Instruction)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("instructions = %q, want %q", got, tt.want)
+			}
+			if last := instructions[len(instructions)-1]; last.Maneuver != "arrive" {
+				t.Errorf("last instruction %q is no arrival", last.Instruction)
+			}
+		})
+	}
+}
+
+func TestBuildRouteStopCount(t *testing.T) {
+	setupRouter(t)
+	req := validInput()
+	ApplyDefaults(&req)
+	out, err := BuildRoute(t.Context(), testClient(straightRoute(turnTestRoute...)), req, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The slight left, the sharp right and the exit; no step is an intersection
+	if got := out.Routes[0].StopCount; got != 3 {
+		t.Errorf("StopCount = %d, want 3", got)
+	}
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"bike-router/router/routertest"
+	"bike-router/utils"
+	"testing"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+var _ MapsClient = (*routertest.MapsClient)(nil)
+
+// setupRouter gives a test empty caches and the default phrases, and restores
+// the package settings it may change afterwards
+func setupRouter(t *testing.T) {
+	t.Helper()
+	savedConfig, savedRetry, savedThreshold, savedWeather := config, mapsRetry, downhillThresholdMeters, weatherProvider
+	configureCaches(utils.Config{})
+	if err := loadPhraseTemplates(nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		config, mapsRetry, downhillThresholdMeters, weatherProvider = savedConfig, savedRetry, savedThreshold, savedWeather
+		configureCaches(utils.Config{})
+		_ = loadPhraseTemplates(nil)
+	})
+}
+
+// Two steps through San Francisco: north on Market St, then right onto
+// Valencia St
+var (
+	testOrigin      = maps.LatLng{Lat: 37.7749, Lng: -122.4194}
+	testCorner      = maps.LatLng{Lat: 37.7759, Lng: -122.4194}
+	testDestination = maps.LatLng{Lat: 37.7759, Lng: -122.4180}
+)
+
+// testTime is a fixed departure for tests that need one
+var testTime = time.Date(2026, 5, 1, 8, 30, 0, 0, time.UTC)
+
+func testRoute() maps.Route {
+	return routertest.Route(routertest.Leg(
+		routertest.Step("Head <b>north</b> on <b>Market St</b>", testOrigin, testCorner, 111, 30*time.Second),
+		routertest.Step("Turn <b>right</b> onto <b>Valencia St</b>", testCorner, testDestination, 123, 30*time.Second),
+	))
+}
+
+// testClient answers Directions with routes and names every location after
+// the street of the step it starts
+func testClient(routes ...maps.Route) *routertest.MapsClient {
+	streets := map[maps.LatLng]string{testOrigin: "Market St", testCorner: "Valencia St", testDestination: "Valencia St"}
+	return &routertest.MapsClient{
+		DirectionsFunc: func(*maps.DirectionsRequest) ([]maps.Route, error) { return routes, nil },
+		ReverseGeocodeFunc: func(r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+			if street, ok := streets[*r.LatLng]; ok {
+				return []maps.GeocodingResult{routertest.StreetResult(street)}, nil
+			}
+			return nil, nil
+		},
+	}
+}
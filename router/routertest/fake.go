@@ -0,0 +1,155 @@
+// Package routertest provides a fake Maps client and route builders for
+// testing code built on package router without calling Google.
+package routertest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// MapsClient is a router.MapsClient that answers from its function fields and
+// records every request it receives. A nil function answers with no results,
+// except Elevation, which answers 0 m for every location.
+type MapsClient struct {
+	DirectionsFunc     func(*maps.DirectionsRequest) ([]maps.Route, error)
+	ElevationFunc      func(*maps.ElevationRequest) ([]maps.ElevationResult, error)
+	GeocodeFunc        func(*maps.GeocodingRequest) ([]maps.GeocodingResult, error)
+	ReverseGeocodeFunc func(*maps.GeocodingRequest) ([]maps.GeocodingResult, error)
+
+	mu                     sync.Mutex
+	directionsRequests     []*maps.DirectionsRequest
+	elevationRequests      []*maps.ElevationRequest
+	geocodeRequests        []*maps.GeocodingRequest
+	reverseGeocodeRequests []*maps.GeocodingRequest
+}
+
+func (c *MapsClient) Directions(ctx context.Context, r *maps.DirectionsRequest) ([]maps.Route, []maps.GeocodedWaypoint, error) {
+	c.mu.Lock()
+	c.directionsRequests = append(c.directionsRequests, r)
+	c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if c.DirectionsFunc == nil {
+		return nil, nil, nil
+	}
+	routes, err := c.DirectionsFunc(r)
+	return routes, nil, err
+}
+
+func (c *MapsClient) Elevation(ctx context.Context, r *maps.ElevationRequest) ([]maps.ElevationResult, error) {
+	c.mu.Lock()
+	c.elevationRequests = append(c.elevationRequests, r)
+	c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.ElevationFunc == nil {
+		results := make([]maps.ElevationResult, len(r.Locations))
+		for i, ll := range r.Locations {
+			results[i].Location = &maps.LatLng{Lat: ll.Lat, Lng: ll.Lng}
+		}
+		return results, nil
+	}
+	return c.ElevationFunc(r)
+}
+
+func (c *MapsClient) Geocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+	c.mu.Lock()
+	c.geocodeRequests = append(c.geocodeRequests, r)
+	c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.GeocodeFunc == nil {
+		return nil, nil
+	}
+	return c.GeocodeFunc(r)
+}
+
+func (c *MapsClient) ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+	c.mu.Lock()
+	c.reverseGeocodeRequests = append(c.reverseGeocodeRequests, r)
+	c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.ReverseGeocodeFunc == nil {
+		return nil, nil
+	}
+	return c.ReverseGeocodeFunc(r)
+}
+
+// DirectionsRequests returns the Directions requests received so far
+func (c *MapsClient) DirectionsRequests() []*maps.DirectionsRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*maps.DirectionsRequest(nil), c.directionsRequests...)
+}
+
+// ElevationRequests returns the Elevation requests received so far
+func (c *MapsClient) ElevationRequests() []*maps.ElevationRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*maps.ElevationRequest(nil), c.elevationRequests...)
+}
+
+// GeocodeRequests returns the Geocode requests received so far
+func (c *MapsClient) GeocodeRequests() []*maps.GeocodingRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*maps.GeocodingRequest(nil), c.geocodeRequests...)
+}
+
+// ReverseGeocodeRequests returns the ReverseGeocode requests received so far
+func (c *MapsClient) ReverseGeocodeRequests() []*maps.GeocodingRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*maps.GeocodingRequest(nil), c.reverseGeocodeRequests...)
+}
+
+// Step returns a bicycling step from one location to another
+func Step(html string, from, to maps.LatLng, meters int, duration time.Duration) *maps.Step {
+	return &maps.Step{
+		HTMLInstructions: html,
+		Distance:         maps.Distance{Meters: meters},
+		Duration:         duration,
+		StartLocation:    from,
+		EndLocation:      to,
+		TravelMode:       "BICYCLING",
+	}
+}
+
+// Leg returns a leg through the steps, from the first one's start to the last
+// one's end, with their distances and durations summed
+func Leg(steps ...*maps.Step) *maps.Leg {
+	leg := &maps.Leg{Steps: steps}
+	if len(steps) > 0 {
+		leg.StartLocation = steps[0].StartLocation
+		leg.EndLocation = steps[len(steps)-1].EndLocation
+	}
+	for _, s := range steps {
+		leg.Distance.Meters += s.Distance.Meters
+		leg.Duration += s.Duration
+	}
+	return leg
+}
+
+// Route returns a route through the legs
+func Route(legs ...*maps.Leg) maps.Route {
+	return maps.Route{Legs: legs}
+}
+
+// StreetResult is a reverse-geocode result naming only a street
+func StreetResult(street string) maps.GeocodingResult {
+	return maps.GeocodingResult{
+		FormattedAddress: street,
+		AddressComponents: []maps.AddressComponent{
+			{LongName: street, ShortName: street, Types: []string{"route"}},
+		},
+		Types: []string{"route"},
+	}
+}
@@ -0,0 +1,104 @@
+package router
+
+import (
+	"bike-router/entities"
+	"context"
+	"math"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+const (
+	summaryElevationSamples = 64
+	maxElevationSamples     = 512 // Elevation API limit per path request
+)
+
+// Difficulty ratings by average climb per kilometer
+const (
+	difficultyEasy     = "easy"
+	difficultyModerate = "moderate"
+	difficultyHard     = "hard"
+)
+
+// buildRouteSummary describes a route from Google's leg totals and a single
+// elevation request sampled along the overview polyline, without any of the
+// per-step reverse geocoding or elevation lookups of the full response. It
+// also returns the samples, empty when the lookup failed.
+func buildRouteSummary(ctx context.Context, client MapsClient, id int, rt maps.Route, samplesPerKm float64) (entities.RouteSummary, []entities.Point) {
+	summary := entities.RouteSummary{
+		ID: id,
+		Center: entities.Coordinates{
+			Lat: (rt.Bounds.NorthEast.Lat + rt.Bounds.SouthWest.Lat) / 2,
+			Lng: (rt.Bounds.NorthEast.Lng + rt.Bounds.SouthWest.Lng) / 2,
+		},
+	}
+	var duration time.Duration
+	for _, leg := range rt.Legs {
+		summary.DistanceMeters += leg.Distance.Meters
+		duration += leg.Duration
+	}
+	summary.DurationSeconds = int(duration.Seconds())
+
+	var samples []entities.Point
+	if path, err := rt.OverviewPolyline.Decode(); err == nil && len(path) >= 2 {
+		count := elevationSampleCount(summary.DistanceMeters, samplesPerKm)
+		if samples, err = sampleElevations(ctx, client, path, count); err == nil {
+			summary.ElevationGainMeters, _ = elevationTotals(samples)
+		}
+	}
+	summary.Difficulty = difficultyRating(summary.DistanceMeters, summary.ElevationGainMeters)
+	return summary, samples
+}
+
+// elevationSampleCount returns how many elevation samples to take along a
+// route: a fixed count by default, or scaled with distance when a per-km
+// density is given, so short and long routes get the same resolution
+func elevationSampleCount(distanceMeters int, samplesPerKm float64) int {
+	if samplesPerKm <= 0 {
+		return summaryElevationSamples
+	}
+	samples := int(math.Ceil(float64(distanceMeters) / 1000 * samplesPerKm))
+	return min(max(samples, 2), maxElevationSamples)
+}
+
+// sampleElevations fetches evenly spaced elevations along a path in one call,
+// as points
+func sampleElevations(ctx context.Context, client MapsClient, path []maps.LatLng, samples int) ([]entities.Point, error) {
+	if samples > maxElevationSamples {
+		samples = maxElevationSamples
+	}
+	if samples < 2 {
+		samples = 2
+	}
+
+	resp, err := client.Elevation(ctx, &maps.ElevationRequest{Path: path, Samples: samples})
+	if err != nil {
+		return nil, err
+	}
+	points := make([]entities.Point, len(resp))
+	for j, r := range resp {
+		points[j].Elevation = r.Elevation
+		if r.Location != nil {
+			points[j].Lat, points[j].Lng = r.Location.Lat, r.Location.Lng
+		}
+	}
+	return points, nil
+}
+
+// difficultyRating grades a route by its average climb: under 10 m per km is
+// easy, under 20 m per km moderate, anything steeper hard
+func difficultyRating(distanceMeters int, gainMeters float64) string {
+	if distanceMeters <= 0 {
+		return difficultyEasy
+	}
+	perKm := gainMeters / (float64(distanceMeters) / 1000)
+	switch {
+	case perKm < 10:
+		return difficultyEasy
+	case perKm < 20:
+		return difficultyModerate
+	default:
+		return difficultyHard
+	}
+}
@@ -0,0 +1,117 @@
+package router
+
+import (
+	"bike-router/entities"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"bike-router/router/routertest"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// hillTop is 333 m north of testOrigin and 60 m above it; everything else
+// is at sea level
+var hillTop = maps.LatLng{Lat: testOrigin.Lat + 0.003, Lng: testOrigin.Lng}
+
+// hillElevations answers Elevation for locations and for sampled paths,
+// interpolating along the path between its vertices; the path comes from a
+// decoded polyline, so the hill top is matched approximately
+func hillElevations(r *maps.ElevationRequest) ([]maps.ElevationResult, error) {
+	elevation := func(ll maps.LatLng) float64 {
+		if nearLatLng(ll, hillTop) {
+			return 60
+		}
+		return 0
+	}
+	var results []maps.ElevationResult
+	for _, ll := range r.Locations {
+		results = append(results, maps.ElevationResult{Location: &maps.LatLng{Lat: ll.Lat, Lng: ll.Lng}, Elevation: elevation(ll)})
+	}
+	for i := 0; i < r.Samples && len(r.Path) >= 2; i++ {
+		pos := float64(i) / float64(r.Samples-1) * float64(len(r.Path)-1)
+		j := min(int(pos), len(r.Path)-2)
+		f := pos - float64(j)
+		a, b := r.Path[j], r.Path[j+1]
+		results = append(results, maps.ElevationResult{
+			Location:  &maps.LatLng{Lat: a.Lat + f*(b.Lat-a.Lat), Lng: a.Lng + f*(b.Lng-a.Lng)},
+			Elevation: elevation(a) + f*(elevation(b)-elevation(a)),
+		})
+	}
+	return results, nil
+}
+
+func TestSummarizeMatchesBuildRoute(t *testing.T) {
+	// Google's first choice climbs a gravel bike path over the hill; the
+	// alternative is flat and paved
+	hilly := routertest.Route(routertest.Leg(
+		routertest.Step("Head <b>north</b> on <b>Bay Trail</b> bike path<div>Gravel surface</div>", testOrigin, hillTop, 333, 2*time.Minute),
+		routertest.Step("Turn <b>right</b> onto <b>Valencia St</b>", hillTop, testDestination, 250, time.Minute),
+	))
+	hilly.OverviewPolyline.Points = maps.Encode([]maps.LatLng{testOrigin, hillTop, testDestination})
+	flat := testRoute()
+	flat.OverviewPolyline.Points = maps.Encode([]maps.LatLng{testOrigin, testCorner, testDestination})
+
+	tests := []struct {
+		name    string
+		modify  func(*entities.RouteInput)
+		wantIDs []int
+	}{
+		{"every alternative", func(*entities.RouteInput) {}, []int{1, 2}},
+		{"most bike lanes", func(r *entities.RouteInput) { r.Prefer = preferBikeLanes }, []int{1}},
+		{"bike lanes under a climb limit", func(r *entities.RouteInput) {
+			r.Prefer, r.MaxElevationGainMeters = preferBikeLanes, 30
+		}, []int{2}},
+		{"bike lanes under a grade limit", func(r *entities.RouteInput) {
+			r.Prefer, r.MaxGradePercent = preferBikeLanes, 10
+		}, []int{2}},
+		{"bike lanes avoiding unpaved", func(r *entities.RouteInput) {
+			r.Prefer, r.Avoid = preferBikeLanes, []string{avoidUnpaved}
+		}, []int{2}},
+		{"nothing left", func(r *entities.RouteInput) {
+			r.Avoid, r.MaxElevationGainMeters = []string{avoidUnpaved}, 30
+			r.Destination, r.DestinationCoords = "", coords(hillTop)
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupRouter(t)
+			routes := []maps.Route{hilly, flat}
+			if tt.wantIDs == nil {
+				routes = routes[:1]
+			}
+			client := testClient(routes...)
+			client.ElevationFunc = hillElevations
+			req := validInput()
+			req.Alternatives = true
+			tt.modify(&req)
+			ApplyDefaults(&req)
+
+			summaries, summaryErr := Summarize(t.Context(), client, req)
+			out, buildErr := BuildRoute(t.Context(), client, req, Options{})
+			if tt.wantIDs == nil {
+				var noMatch NoMatchingRouteError
+				if !errors.As(summaryErr, &noMatch) || !errors.As(buildErr, &noMatch) {
+					t.Errorf("Summarize() = %v, BuildRoute() = %v, want NoMatchingRouteError from both", summaryErr, buildErr)
+				}
+				return
+			}
+			if summaryErr != nil || buildErr != nil {
+				t.Fatalf("Summarize() = %v, BuildRoute() = %v", summaryErr, buildErr)
+			}
+
+			var summaryIDs, routeIDs []int
+			for _, s := range summaries.Routes {
+				summaryIDs = append(summaryIDs, s.ID)
+			}
+			for _, r := range out.Routes {
+				routeIDs = append(routeIDs, r.ID)
+			}
+			if !slices.Equal(summaryIDs, tt.wantIDs) || !slices.Equal(routeIDs, tt.wantIDs) {
+				t.Errorf("summarized routes %v and built routes %v, want %v", summaryIDs, routeIDs, tt.wantIDs)
+			}
+		})
+	}
+}
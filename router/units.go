@@ -0,0 +1,57 @@
+package router
+
+import (
+	"bike-router/entities"
+	"fmt"
+	"math"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// Unit systems accepted in RouteInput.Units
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+)
+
+var directionsUnits = map[string]maps.Units{
+	unitsMetric:   maps.UnitsMetric,
+	unitsImperial: maps.UnitsImperial,
+}
+
+const (
+	feetPerMeter  = 3.28084
+	metersPerMile = 1609.344
+)
+
+// formatDistance renders a distance for display in the requested units.
+// Short distances use meters or feet, rounded to 10; longer ones kilometers
+// or miles with one decimal.
+func formatDistance(meters int, units string) string {
+	if units == unitsImperial {
+		if miles := float64(meters) / metersPerMile; miles >= 0.1 {
+			return fmt.Sprintf("%.1f mi", miles)
+		}
+		return fmt.Sprintf("%d ft", int(math.Round(float64(meters)*feetPerMeter/10)*10))
+	}
+	if meters >= 1000 {
+		return fmt.Sprintf("%.1f km", float64(meters)/metersPerKilometer)
+	}
+	return fmt.Sprintf("%d m", int(math.Round(float64(meters)/10)*10))
+}
+
+// markerIntervalMeters is the spacing of the distance markers: a kilometer,
+// or a mile in imperial units
+func markerIntervalMeters(units string) float64 {
+	if units == unitsImperial {
+		return metersPerMile
+	}
+	return metersPerKilometer
+}
+
+// addDistanceText fills each instruction's formatted cumulative distance
+func addDistanceText(instructions []entities.Instruction, units string) {
+	for i := range instructions {
+		instructions[i].DistanceText = formatDistance(instructions[i].DistanceMeters, units)
+	}
+}
@@ -0,0 +1,36 @@
+package router
+
+import (
+	"bike-router/entities"
+	"math"
+	"testing"
+)
+
+func TestDistanceMarkers(t *testing.T) {
+	// About 5 km due north, in two segments
+	points := []entities.Point{{Lat: 0}, {Lat: 0.02}, {Lat: 0.045}}
+	tests := []struct {
+		units      string
+		wantCount  int
+		wantFirstM float64
+	}{
+		{unitsMetric, 5, 1000},
+		{unitsImperial, 3, 1609.344},
+	}
+	for _, tt := range tests {
+		t.Run(tt.units, func(t *testing.T) {
+			markers := distanceMarkers(points, markerIntervalMeters(tt.units))
+			if len(markers) != tt.wantCount {
+				t.Fatalf("got %d markers, want %d", len(markers), tt.wantCount)
+			}
+			for i, m := range markers {
+				if m.Value != i+1 {
+					t.Errorf("marker %d has value %d", i, m.Value)
+				}
+			}
+			if d := haversine(0, 0, markers[0].Lat, markers[0].Lng); math.Abs(d-tt.wantFirstM) > 0.5 {
+				t.Errorf("first marker at %.1f m, want %.1f", d, tt.wantFirstM)
+			}
+		})
+	}
+}
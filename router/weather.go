@@ -0,0 +1,166 @@
+package router
+
+import (
+	"bike-router/entities"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WeatherForecast is what a provider expects during a ride window
+type WeatherForecast struct {
+	WindSpeedMps             float64 // sustained wind speed
+	WindFromDegrees          float64 // compass direction the wind blows from
+	PrecipitationProbability float64 // highest chance of rain in the window, 0-1
+}
+
+// WeatherProvider looks up the forecast around a location. It is the only
+// network dependency of ride advisories, so it can be swapped or left unset.
+type WeatherProvider interface {
+	Forecast(ctx context.Context, lat, lng float64, start, end time.Time) (WeatherForecast, error)
+}
+
+// weatherProvider is nil unless enabled in config, which turns advisories off
+var weatherProvider WeatherProvider
+
+const (
+	windAdvisoryMps     = 5.0 // wind below this isn't worth mentioning
+	rainAdvisoryChance  = 0.5
+	headwindWithinDeg   = 45.0
+	tailwindBeyondDeg   = 135.0
+	weatherLookupBudget = 3 * time.Second
+)
+
+// weatherAdvisories turns a forecast into ride advisories, comparing the wind
+// against the route's net heading (first point to last point)
+func weatherAdvisories(route entities.Route, forecast WeatherForecast) []string {
+	advisories := []string{}
+
+	if n := len(route.Points); n >= 2 && forecast.WindSpeedMps >= windAdvisoryMps {
+		first, last := route.Points[0], route.Points[n-1]
+		heading := bearing(first.Lat, first.Lng, last.Lat, last.Lng)
+		// Angle between where we ride to and where the wind comes from
+		offset := math.Abs(turnAngleDegrees(heading, forecast.WindFromDegrees))
+		switch {
+		case offset <= headwindWithinDeg:
+			advisories = append(advisories, fmt.Sprintf("headwind of %.0f m/s for most of the ride", forecast.WindSpeedMps))
+		case offset >= tailwindBeyondDeg:
+			advisories = append(advisories, fmt.Sprintf("tailwind of %.0f m/s for most of the ride", forecast.WindSpeedMps))
+		default:
+			advisories = append(advisories, fmt.Sprintf("crosswind of %.0f m/s for most of the ride", forecast.WindSpeedMps))
+		}
+	}
+
+	if forecast.PrecipitationProbability >= rainAdvisoryChance {
+		advisories = append(advisories, fmt.Sprintf("rain expected during the ride window (%.0f%% chance)", forecast.PrecipitationProbability*100))
+	}
+	return advisories
+}
+
+// rideWindow is the span of time the routes of one request are ridden in
+type rideWindow struct {
+	start, end time.Time
+}
+
+// add widens the window to cover a ride departing at depart
+func (w *rideWindow) add(depart time.Time, duration time.Duration) {
+	if w.start.IsZero() || depart.Before(w.start) {
+		w.start = depart
+	}
+	if arrive := depart.Add(duration); arrive.After(w.end) {
+		w.end = arrive
+	}
+}
+
+// rideForecast asks the configured provider about the window at the trip's
+// start. Lookup failures just mean no advisories.
+func rideForecast(ctx context.Context, lat, lng float64, window rideWindow) (WeatherForecast, bool) {
+	ctx, cancel := context.WithTimeout(ctx, weatherLookupBudget)
+	defer cancel()
+
+	forecast, err := weatherProvider.Forecast(ctx, lat, lng, window.start, window.end)
+	if err != nil {
+		slog.WarnContext(ctx, "weather forecast failed", "error", err.Error())
+		return WeatherForecast{}, false
+	}
+	return forecast, true
+}
+
+// openMeteoProvider reads hourly forecasts from the keyless Open-Meteo API
+type openMeteoProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newOpenMeteoProvider() *openMeteoProvider {
+	return &openMeteoProvider{
+		baseURL: "https://api.open-meteo.com/v1/forecast",
+		client:  &http.Client{Timeout: weatherLookupBudget},
+	}
+}
+
+func (p *openMeteoProvider) Forecast(ctx context.Context, lat, lng float64, start, end time.Time) (WeatherForecast, error) {
+	q := url.Values{}
+	q.Set("latitude", fmt.Sprintf("%f", lat))
+	q.Set("longitude", fmt.Sprintf("%f", lng))
+	q.Set("hourly", "wind_speed_10m,wind_direction_10m,precipitation_probability")
+	q.Set("wind_speed_unit", "ms")
+	q.Set("timezone", "UTC")
+	q.Set("forecast_days", "2")
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return WeatherForecast{}, err
+	}
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return WeatherForecast{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return WeatherForecast{}, fmt.Errorf("open-meteo: status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Hourly struct {
+			Time          []string  `json:"time"`
+			WindSpeed     []float64 `json:"wind_speed_10m"`
+			WindDirection []float64 `json:"wind_direction_10m"`
+			Precipitation []float64 `json:"precipitation_probability"`
+		} `json:"hourly"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return WeatherForecast{}, err
+	}
+
+	h := body.Hourly
+	if len(h.WindSpeed) < len(h.Time) || len(h.WindDirection) < len(h.Time) || len(h.Precipitation) < len(h.Time) {
+		return WeatherForecast{}, fmt.Errorf("open-meteo: incomplete hourly data")
+	}
+
+	var forecast WeatherForecast
+	found := false
+	windowStart := start.Truncate(time.Hour)
+	for i, ts := range h.Time {
+		hour, err := time.Parse("2006-01-02T15:04", ts)
+		if err != nil || hour.Before(windowStart) || hour.After(end) {
+			continue
+		}
+		if !found {
+			// Wind at the start hour stands in for the whole ride
+			forecast.WindSpeedMps = h.WindSpeed[i]
+			forecast.WindFromDegrees = h.WindDirection[i]
+			found = true
+		}
+		forecast.PrecipitationProbability = math.Max(forecast.PrecipitationProbability, h.Precipitation[i]/100)
+	}
+	if !found {
+		return WeatherForecast{}, fmt.Errorf("open-meteo: no forecast for the ride window")
+	}
+	return forecast, nil
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"bike-router/router/routertest"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	maps "googlemaps.github.io/maps"
+)
+
+// fakeWeather answers every lookup with forecast and records the places and
+// windows asked about
+type fakeWeather struct {
+	forecast WeatherForecast
+
+	mu        sync.Mutex
+	locations []maps.LatLng
+	windows   [][2]time.Time
+}
+
+func (f *fakeWeather) Forecast(_ context.Context, lat, lng float64, start, end time.Time) (WeatherForecast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.locations = append(f.locations, maps.LatLng{Lat: lat, Lng: lng})
+	f.windows = append(f.windows, [2]time.Time{start, end})
+	return f.forecast, nil
+}
+
+func TestBuildRouteWeather(t *testing.T) {
+	setupRouter(t)
+	weather := &fakeWeather{forecast: WeatherForecast{PrecipitationProbability: 0.8}}
+	weatherProvider = weather
+
+	// A second, slower alternative
+	slow := routertest.Route(routertest.Leg(
+		routertest.Step("Head <b>east</b> on <b>Market St</b>", testOrigin, testDestination, 300, 5*time.Minute),
+	))
+	req := validInput()
+	req.Alternatives = true
+	req.DepartureTime.Time = testTime
+	ApplyDefaults(&req)
+
+	out, err := BuildRoute(t.Context(), testClient(testRoute(), slow), req, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(weather.windows) != 1 {
+		t.Fatalf("%d forecast lookups for %d routes, want 1", len(weather.windows), len(out.Routes))
+	}
+	if got := weather.windows[0]; !got[0].Equal(testTime) || !got[1].Equal(testTime.Add(5*time.Minute)) {
+		t.Errorf("forecast window = %v to %v, want the departure to the slowest arrival", got[0], got[1])
+	}
+	for _, route := range out.Routes {
+		if len(route.Advisories) != 1 {
+			t.Errorf("route %d advisories = %q, want the rain advisory", route.ID, route.Advisories)
+		}
+	}
+}
+
+func TestRideWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		rides      [][2]time.Duration // departure offset from testTime, duration
+		start, end time.Duration
+	}{
+		{"one ride", [][2]time.Duration{{0, time.Hour}}, 0, time.Hour},
+		{"longer ride later", [][2]time.Duration{{0, time.Hour}, {time.Hour, 2 * time.Hour}}, 0, 3 * time.Hour},
+		{"earlier departure", [][2]time.Duration{{time.Hour, time.Hour}, {0, 30 * time.Minute}}, 0, 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w rideWindow
+			for _, ride := range tt.rides {
+				w.add(testTime.Add(ride[0]), ride[1])
+			}
+			if !w.start.Equal(testTime.Add(tt.start)) || !w.end.Equal(testTime.Add(tt.end)) {
+				t.Errorf("window = %v to %v, want %v to %v", w.start, w.end, testTime.Add(tt.start), testTime.Add(tt.end))
+			}
+		})
+	}
+}
@@ -1,23 +1,245 @@
 package utils
 
 import (
-	"log"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
-func LoadConfig() string {
+type Config struct {
+	GoogleMapsAPIKeys []string // Calls rotate across the keys; one is enough
+
+	// HTTP server
+	Port         string
+	ReadTimeout  time.Duration // Reading the whole request, body included
+	WriteTimeout time.Duration // From the end of the request headers to the end of the response
+	IdleTimeout  time.Duration // Keep-alive connections waiting for the next request
+
+	ShutdownTimeout time.Duration // How long in-flight requests may finish after SIGINT/SIGTERM
+
+	RequestTimeout time.Duration // Deadline shared by all Maps calls made for one request
+
+	// Token bucket in front of every Maps API call; 0 disables it
+	MapsRateLimit float64 // Calls per second
+	MapsRateBurst int     // Calls allowed at once after a quiet period; defaults to the rate
+
+	// Retries of transient Maps API failures (rate limits, 5xx, timeouts)
+	MapsMaxAttempts int
+	RetryBaseDelay  time.Duration
+	RetryMaxDelay   time.Duration
+	RetryJitter     bool          // Randomize waits so instances don't retry in lockstep
+	MapsKeyCooldown time.Duration // How long an API key over quota is left out of the rotation
+
+	WarmupLocations []string // "lat,lng" pairs or addresses primed into the caches at startup
+	MaxWaypoints    int
+
+	ReconcileLegDistances   bool              // Rescale instruction distances to match Google's leg totals exactly
+	CarCO2GramsPerKm        float64           // Tailpipe emissions of the car a ride replaces, for CO2 savings
+	DownhillThresholdMeters float64           // Minimum drop for a segment to be flagged downhill
+	RecordRequestsFile      string            // JSONL file route requests are appended to for replay; empty disables
+	WeatherProvider         string            // "open-meteo" enables weather advisories; empty disables them
+	PhraseTemplates         map[string]string // text/template overrides for synthesized instructions, by phrase type
+
+	// Maximum in-flight calls per Maps API, tuned to each API's quota
+	ElevationConcurrency int
+	GeocodeConcurrency   int
+	LookupWorkers        int // Parallel lookups within one request, so one long route can't take every slot
+
+	// ntfy notifications; an empty URL disables them
+	NtfyURL        string // e.g. https://ntfy.sh or a self-hosted server
+	NtfyErrorTopic string
+	NtfyInfoTopic  string
+	NotifyLevel    slog.Level // Lowest level of the records sent
+
+	// Privacy snapping of the route ends to a coarse lat/lng grid
+	SnapOrigin      bool
+	SnapDestination bool
+	SnapDecimals    int
+
+	// Lookup cache limits; 0 leaves a cache unbounded or its entries unexpiring
+	ElevationCacheMaxEntries int
+	ElevationCacheTTL        time.Duration
+	GeocodeCacheMaxEntries   int
+	GeocodeCacheTTL          time.Duration
+}
+
+func LoadConfig() Config {
 	envFile, _ := godotenv.Read(".env")
 
-	envFileGoogleMapsApiKey := envFile["GOOGLE_MAPS_API_KEY"]
-	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
-	if apiKey == "" {
-		apiKey = envFileGoogleMapsApiKey
+	apiKeys := splitList(getEnv(envFile, "GOOGLE_MAPS_API_KEYS"), ",")
+	if len(apiKeys) == 0 {
+		apiKeys = splitList(getEnv(envFile, "GOOGLE_MAPS_API_KEY"), ",")
+	}
+	if len(apiKeys) == 0 {
+		slog.Error("set GOOGLE_MAPS_API_KEY or GOOGLE_MAPS_API_KEYS environment variable")
+		os.Exit(1)
+	}
+
+	snap := strings.ToLower(getEnv(envFile, "PRIVACY_SNAP"))
+
+	return Config{
+		GoogleMapsAPIKeys: apiKeys,
+		Port:              getEnvDefault(envFile, "PORT", "8080"),
+		ReadTimeout:       getEnvDuration(envFile, "READ_TIMEOUT", 10*time.Second),
+		// A route with many steps makes many Maps calls before it can answer
+		WriteTimeout: getEnvDuration(envFile, "WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:  getEnvDuration(envFile, "IDLE_TIMEOUT", 120*time.Second),
+		// Enough for a route that uses its whole REQUEST_TIMEOUT
+		ShutdownTimeout: getEnvDuration(envFile, "SHUTDOWN_TIMEOUT", 50*time.Second),
+		// Below WriteTimeout, so a timed-out request still gets its error body
+		RequestTimeout:  getEnvDuration(envFile, "REQUEST_TIMEOUT", 45*time.Second),
+		MapsRateLimit:   getEnvFloat(envFile, "MAPS_RATE_LIMIT", 0),
+		MapsRateBurst:   getEnvInt(envFile, "MAPS_RATE_BURST", 0),
+		MapsMaxAttempts: getEnvInt(envFile, "MAPS_MAX_ATTEMPTS", 3),
+		RetryBaseDelay:  getEnvDuration(envFile, "RETRY_BASE_DELAY", 200*time.Millisecond),
+		RetryMaxDelay:   getEnvDuration(envFile, "RETRY_MAX_DELAY", 5*time.Second),
+		RetryJitter:     getEnvBool(envFile, "RETRY_JITTER", true),
+		MapsKeyCooldown: getEnvDuration(envFile, "MAPS_KEY_COOLDOWN", time.Minute),
+		WarmupLocations: splitList(getEnv(envFile, "WARMUP_LOCATIONS"), ";"),
+		// Google bills requests with more than 10 waypoints at the higher Advanced rate
+		MaxWaypoints:          getEnvInt(envFile, "MAX_WAYPOINTS", 10),
+		ReconcileLegDistances: getEnvBool(envFile, "RECONCILE_LEG_DISTANCES", false),
+		// Average new passenger car in the EU, WLTP
+		CarCO2GramsPerKm:        getEnvFloat(envFile, "CAR_CO2_GRAMS_PER_KM", 110),
+		RecordRequestsFile:      getEnv(envFile, "RECORD_REQUESTS_FILE"),
+		DownhillThresholdMeters: getEnvFloat(envFile, "DOWNHILL_THRESHOLD_METERS", 1),
+		WeatherProvider:         strings.ToLower(getEnv(envFile, "WEATHER_PROVIDER")),
+		ElevationConcurrency:    getEnvInt(envFile, "ELEVATION_CONCURRENCY", 10),
+		GeocodeConcurrency:      getEnvInt(envFile, "GEOCODE_CONCURRENCY", 10),
+		LookupWorkers:           getEnvInt(envFile, "LOOKUP_WORKERS", 4),
+		NtfyURL:                 getEnv(envFile, "NTFY_URL"),
+		NtfyErrorTopic:          getEnvDefault(envFile, "NTFY_ERROR_TOPIC", "bike-byui-hack-errors"),
+		NtfyInfoTopic:           getEnvDefault(envFile, "NTFY_INFO_TOPIC", "bike-byui-hack-info"),
+		// Only failures by default: a notification per request is noise
+		NotifyLevel:     getEnvLevel(envFile, "NOTIFY_LEVEL", slog.LevelInfo),
+		SnapOrigin:      snap == "origin" || snap == "both",
+		SnapDestination: snap == "destination" || snap == "both",
+		SnapDecimals:    getEnvInt(envFile, "PRIVACY_SNAP_DECIMALS", 3),
+		// Elevation never changes, so it only needs a size cap; addresses do, slowly
+		ElevationCacheMaxEntries: getEnvInt(envFile, "ELEVATION_CACHE_MAX_ENTRIES", 100000),
+		ElevationCacheTTL:        getEnvDuration(envFile, "ELEVATION_CACHE_TTL", 0),
+		GeocodeCacheMaxEntries:   getEnvInt(envFile, "GEOCODE_CACHE_MAX_ENTRIES", 50000),
+		GeocodeCacheTTL:          getEnvDuration(envFile, "GEOCODE_CACHE_TTL", 24*time.Hour),
+		PhraseTemplates:          getPhraseTemplates(envFile),
+	}
+}
+
+// phraseTemplateKeys names the setting overriding each phrase type's template
+var phraseTemplateKeys = map[string]string{
+	"arrive":      "TEMPLATE_ARRIVE",
+	"destination": "TEMPLATE_DESTINATION",
+	"continue":    "TEMPLATE_CONTINUE",
+	"turn-left":   "TEMPLATE_TURN_LEFT",
+	"turn-right":  "TEMPLATE_TURN_RIGHT",
+}
+
+// getPhraseTemplates reads the phrase template overrides that are set, by
+// phrase type.
+func getPhraseTemplates(envFile map[string]string) map[string]string {
+	templates := map[string]string{}
+	for kind, key := range phraseTemplateKeys {
+		if value := getEnv(envFile, key); value != "" {
+			templates[kind] = value
+		}
+	}
+	return templates
+}
+
+// getEnv prefers the process environment and falls back to the .env file.
+func getEnv(envFile map[string]string, key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return envFile[key]
+}
+
+// getEnvDefault reads a string setting, using def when unset.
+func getEnvDefault(envFile map[string]string, key, def string) string {
+	if value := getEnv(envFile, key); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvInt reads an integer setting, using def when unset or invalid.
+func getEnvInt(envFile map[string]string, key string, def int) int {
+	value := getEnv(envFile, key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("invalid setting, using default", "key", key, "value", value, "default", def)
+		return def
+	}
+	return n
+}
+
+// getEnvFloat reads a decimal setting, using def when unset or invalid.
+func getEnvFloat(envFile map[string]string, key string, def float64) float64 {
+	value := getEnv(envFile, key)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("invalid setting, using default", "key", key, "value", value, "default", def)
+		return def
+	}
+	return f
+}
+
+// getEnvBool reads a strconv.ParseBool setting ("true", "1", "false", ...),
+// using def when unset or invalid.
+func getEnvBool(envFile map[string]string, key string, def bool) bool {
+	b, err := strconv.ParseBool(getEnv(envFile, key))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// getEnvDuration reads a time.ParseDuration setting ("90s", "24h"), using def
+// when unset or invalid.
+func getEnvDuration(envFile map[string]string, key string, def time.Duration) time.Duration {
+	value := getEnv(envFile, key)
+	if value == "" {
+		return def
 	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("invalid setting, using default", "key", key, "value", value, "default", def.String())
+		return def
+	}
+	return d
+}
+
+// getEnvLevel reads a log level setting ("info", "warn", "error"), using def
+// when unset or invalid.
+func getEnvLevel(envFile map[string]string, key string, def slog.Level) slog.Level {
+	value := getEnv(envFile, key)
+	if value == "" {
+		return def
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		slog.Warn("invalid setting, using default", "key", key, "value", value, "default", def.String())
+		return def
+	}
+	return level
+}
 
-	if apiKey == "" {
-		log.Fatal("set GOOGLE_MAPS_API_KEY environment variable")
+// splitList splits a separated env value, dropping blank entries.
+func splitList(value, sep string) []string {
+	var out []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
 	}
-	return apiKey
+	return out
 }
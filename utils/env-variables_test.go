@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestLoadConfigPhraseTemplates(t *testing.T) {
+	t.Setenv("GOOGLE_MAPS_API_KEY", "test-key")
+	t.Setenv("TEMPLATE_ARRIVE", "Ride to {{.Street}}")
+	t.Setenv("TEMPLATE_DESTINATION", "")
+	t.Setenv("TEMPLATE_TURN_LEFT", "Left{{with .Street}} to {{.}}{{end}}")
+
+	cfg := LoadConfig()
+	if got := cfg.PhraseTemplates["arrive"]; got != "Ride to {{.Street}}" {
+		t.Errorf(`PhraseTemplates["arrive"] = %q, want the TEMPLATE_ARRIVE value`, got)
+	}
+	if got := cfg.PhraseTemplates["turn-left"]; got != "Left{{with .Street}} to {{.}}{{end}}" {
+		t.Errorf(`PhraseTemplates["turn-left"] = %q, want the TEMPLATE_TURN_LEFT value`, got)
+	}
+	if _, ok := cfg.PhraseTemplates["destination"]; ok {
+		t.Error("an unset TEMPLATE_DESTINATION must leave the default in place")
+	}
+}
+
+func TestLoadConfigNotifyLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  slog.Level
+	}{
+		{"every request by default", "", slog.LevelInfo},
+		{"warnings and errors", "warn", slog.LevelWarn},
+		{"errors only", "ERROR", slog.LevelError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOOGLE_MAPS_API_KEY", "test-key")
+			t.Setenv("NOTIFY_LEVEL", tt.value)
+			if got := LoadConfig().NotifyLevel; got != tt.want {
+				t.Errorf("NotifyLevel = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
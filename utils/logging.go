@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// NotifyKey marks a log record as an event worth an ntfy notification. Its
+// value names the component, which becomes the notification's context.
+const NotifyKey = "component"
+
+// RequestIDKey is the log attribute holding the ID of the request a record
+// was logged for
+const RequestIDKey = "request_id"
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context whose log records, when logged with it
+// (slog.InfoContext and the like), carry the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestID returns the ID set by WithRequestID, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// NewLogger writes JSON log lines to w. Records carrying NotifyKey at or above
+// the configured notify level (errors by default) are also queued for ntfy:
+// warnings and errors to the error topic, the rest to info. Logging never
+// waits for ntfy.
+func NewLogger(w io.Writer) *slog.Logger {
+	return slog.New(notifyHandler{slog.NewJSONHandler(w, nil)})
+}
+
+type notifyHandler struct {
+	slog.Handler
+}
+
+func (h notifyHandler) Handle(ctx context.Context, r slog.Record) error {
+	requestID := RequestID(ctx)
+	logged := r
+	if requestID != "" {
+		logged = r.Clone()
+		logged.AddAttrs(slog.String(RequestIDKey, requestID))
+	}
+	err := h.Handler.Handle(ctx, logged)
+
+	component := ""
+	parts := []string{r.Message}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == NotifyKey {
+			component = a.Value.String()
+		} else {
+			parts = append(parts, a.String())
+		}
+		return true
+	})
+	if component == "" || r.Level < notifyLevel {
+		return err
+	}
+
+	text := strings.Join(parts, " ")
+	message := FormatInfoNotification(text, component, requestID)
+	if r.Level >= slog.LevelWarn {
+		message = FormatErrorNotification(errors.New(text), component, requestID)
+	}
+	report := func(sendErr error) {
+		// Logged through the wrapped handler so the failure can't notify in
+		// turn, and without ctx, which may be long gone by the time it fails
+		failed := slog.NewRecord(time.Now(), slog.LevelWarn, "notification failed", 0)
+		failed.AddAttrs(slog.String("error", sendErr.Error()), slog.String("notification", r.Message))
+		if requestID != "" {
+			failed.AddAttrs(slog.String(RequestIDKey, requestID))
+		}
+		_ = h.Handler.Handle(context.Background(), failed)
+	}
+	if queueErr := queueNotification(message, report); queueErr != nil {
+		report(queueErr)
+	}
+	return err
+}
+
+func (h notifyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return notifyHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h notifyHandler) WithGroup(name string) slog.Handler {
+	return notifyHandler{h.Handler.WithGroup(name)}
+}
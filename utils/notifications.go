@@ -1,8 +1,14 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,24 +18,133 @@ type Message struct {
 	TimeNow time.Time `json:"time_now"`
 }
 
-func SendNotification(message Message) {
+// ntfy server, topics and the lowest level notified, set from the config by
+// ConfigureNotifications. Until then, or with no URL configured,
+// notifications are dropped.
+var (
+	ntfyURL        string
+	ntfyErrorTopic = "bike-byui-hack-errors"
+	ntfyInfoTopic  = "bike-byui-hack-info"
+	notifyLevel    = slog.LevelInfo
+)
+
+// ConfigureNotifications points notifications at cfg's ntfy server and topics
+func ConfigureNotifications(cfg Config) {
+	ntfyURL = strings.TrimSuffix(cfg.NtfyURL, "/")
+	ntfyErrorTopic = cfg.NtfyErrorTopic
+	ntfyInfoTopic = cfg.NtfyInfoTopic
+	notifyLevel = cfg.NotifyLevel
+}
+
+// notifyClient bounds each post, so one slow ntfy server can't stall the queue for long
+var notifyClient = &http.Client{Timeout: 5 * time.Second}
+
+// notifyQueueSize bounds the notifications waiting to be posted. When ntfy
+// can't keep up, new ones are dropped rather than holding up the requests
+// that logged them.
+const notifyQueueSize = 100
+
+var errNotifyQueueFull = errors.New("notification queue full")
+
+type queuedNotification struct {
+	message   Message
+	onFailure func(error) // Called from the sender when the post fails
+}
+
+var (
+	notifyQueue   = make(chan queuedNotification, notifyQueueSize)
+	notifyStart   sync.Once
+	notifyPending atomic.Int64 // Queued or being posted
+)
+
+// queueNotification hands message to the background sender without waiting
+// for it to be posted. It returns errNotifyQueueFull, having dropped the
+// message, when the queue is full.
+func queueNotification(message Message, onFailure func(error)) error {
+	if ntfyURL == "" {
+		return nil
+	}
+	notifyStart.Do(func() { go sendQueuedNotifications() })
+	notifyPending.Add(1)
+	select {
+	case notifyQueue <- queuedNotification{message: message, onFailure: onFailure}:
+		return nil
+	default:
+		notifyPending.Add(-1)
+		return errNotifyQueueFull
+	}
+}
+
+// sendQueuedNotifications posts queued notifications one at a time, for the
+// life of the process
+func sendQueuedNotifications() {
+	for n := range notifyQueue {
+		if err := SendNotification(n.message); err != nil && n.onFailure != nil {
+			n.onFailure(err)
+		}
+		notifyPending.Add(-1)
+	}
+}
+
+// FlushNotifications waits up to timeout for the queued notifications to be
+// posted, so those logged just before the process exits aren't lost. It
+// reports whether the queue emptied in time.
+func FlushNotifications(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for notifyPending.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// SendNotification posts message to its ntfy topic and waits for the answer.
+// It is a no-op returning nil when no ntfy URL is configured. Logged
+// notifications are queued and sent in the background instead.
+func SendNotification(message Message) error {
+	if ntfyURL == "" {
+		return nil
+	}
 	message.TimeNow = time.Now()
-	http.Post("https://ntfy.sh/"+message.Topic, "text/plain",
+	resp, err := notifyClient.Post(ntfyURL+"/"+message.Topic, "text/plain",
 		strings.NewReader(message.Content+"\nTime: "+message.TimeNow.Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain so the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("ntfy returned %s", resp.Status)
+	}
+	return nil
 }
 
-func FormatErrorNotification(err error, context string) Message {
+// FormatErrorNotification builds a message for the error topic. requestID,
+// when not empty, lets the notification be matched with the server's logs.
+func FormatErrorNotification(err error, context, requestID string) Message {
 	return Message{
-		Content: "Error occurred: " + err.Error() + " | Context: " + context,
-		Topic:   "bike-byui-hack-errors",
+		Content: "Error occurred: " + err.Error() + " | Context: " + context + requestIDSuffix(requestID),
+		Topic:   ntfyErrorTopic,
 		TimeNow: time.Now(),
 	}
 }
 
-func FormatInfoNotification(info string, context string) Message {
+// FormatInfoNotification builds a message for the info topic, like
+// FormatErrorNotification
+func FormatInfoNotification(info, context, requestID string) Message {
 	return Message{
-		Content: "Info: " + info + " | Context: " + context,
-		Topic:   "bike-byui-hack-info",
+		Content: "Info: " + info + " | Context: " + context + requestIDSuffix(requestID),
+		Topic:   ntfyInfoTopic,
 		TimeNow: time.Now(),
 	}
 }
+
+func requestIDSuffix(requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	return " | Request ID: " + requestID
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNtfy records the topics posted to; posts block while hold is locked
+type fakeNtfy struct {
+	mu     sync.Mutex
+	topics []string
+	hold   sync.Mutex
+}
+
+func (f *fakeNtfy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.hold.Lock()
+	f.hold.Unlock()
+	_, _ = io.Copy(io.Discard, r.Body)
+	f.mu.Lock()
+	f.topics = append(f.topics, strings.TrimPrefix(r.URL.Path, "/"))
+	f.mu.Unlock()
+}
+
+func (f *fakeNtfy) posted() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.topics...)
+}
+
+// withNtfy points notifications at a fake server at the given level
+func withNtfy(t *testing.T, level slog.Level) *fakeNtfy {
+	t.Helper()
+	ntfy := &fakeNtfy{}
+	server := httptest.NewServer(ntfy)
+	saved := Config{NtfyURL: ntfyURL, NtfyErrorTopic: ntfyErrorTopic, NtfyInfoTopic: ntfyInfoTopic, NotifyLevel: notifyLevel}
+	ConfigureNotifications(Config{NtfyURL: server.URL, NtfyErrorTopic: "errors", NtfyInfoTopic: "info", NotifyLevel: level})
+	t.Cleanup(func() {
+		if !FlushNotifications(5 * time.Second) {
+			t.Error("queued notifications weren't sent")
+		}
+		server.Close()
+		ConfigureNotifications(saved)
+	})
+	return ntfy
+}
+
+func TestNotifyLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level slog.Level
+		want  []string // topics, in the order logged below
+	}{
+		{"errors only", slog.LevelError, []string{"errors"}},
+		{"warnings", slog.LevelWarn, []string{"errors", "errors"}},
+		{"everything by default", slog.LevelInfo, []string{"info", "errors", "errors"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ntfy := withNtfy(t, tt.level)
+			logger := NewLogger(io.Discard)
+			logger.Info("request", NotifyKey, "Route Handler", "status", 200)
+			FlushNotifications(5 * time.Second)
+			logger.Warn("request", NotifyKey, "Route Handler", "status", 404)
+			FlushNotifications(5 * time.Second)
+			logger.Error("request", NotifyKey, "Route Handler", "status", 500)
+			logger.Error("no component, no notification")
+			FlushNotifications(5 * time.Second)
+
+			if got := ntfy.posted(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("notified topics = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotificationsDontBlockLogging(t *testing.T) {
+	ntfy := withNtfy(t, slog.LevelError)
+	ntfy.hold.Lock()
+
+	var logs bytes.Buffer
+	logger := NewLogger(&logs)
+	ctx := WithRequestID(context.Background(), "req-1")
+	start := time.Now()
+	for range notifyQueueSize + 5 {
+		logger.ErrorContext(ctx, "request", NotifyKey, "Route Handler", "status", 500)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("logging waited %s for ntfy", elapsed)
+	}
+	ntfy.hold.Unlock()
+	FlushNotifications(5 * time.Second)
+
+	// One post in flight plus a full queue; the rest were dropped and logged
+	if got := len(ntfy.posted()); got > notifyQueueSize+1 || got < notifyQueueSize {
+		t.Errorf("%d notifications posted, want the queue's %d (+1 in flight)", got, notifyQueueSize)
+	}
+	if !strings.Contains(logs.String(), `"msg":"notification failed","error":"notification queue full"`) {
+		t.Errorf("dropped notifications weren't logged:\n%s", logs.String())
+	}
+}